@@ -0,0 +1,308 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the format of each line of an AccessLog.
+type AccessLogFormat int
+
+const (
+	// AccessLogJSON writes each call as a JSON object on its own line,
+	// also known as NDJSON, with the keys "time", "remote_addr",
+	// "method", "id", "notification", "duration_ms", "code",
+	// "response_bytes", and optionally "params" and "result".
+	AccessLogJSON AccessLogFormat = iota
+
+	// AccessLogText writes each call as a line of text resembling the
+	// Common Log Format:
+	//
+	//	remote_addr [time] "method" id code response_bytes duration
+	//
+	// The id is "-" for Notifications. Any params and result follow as
+	// params=<json> and result=<json>.
+	AccessLogText
+)
+
+// AccessLogRedacted replaces the value of each redacted field path in an
+// AccessLog.
+const AccessLogRedacted = "[REDACTED]"
+
+// AccessLog configures an access log, which records one line for each call
+// received by the HTTPRequestHandler. See WithAccessLog.
+type AccessLog struct {
+	// Writer receives each line. Writes are serialized.
+	Writer io.Writer
+
+	// Format of each line.
+	Format AccessLogFormat
+
+	// Params and Result enable logging the "params" of each Request and
+	// the "result" of each Response.
+	Params bool
+	Result bool
+
+	// Redact lists field paths whose values are replaced with
+	// AccessLogRedacted. A path is a dot separated list of object keys or
+	// array indexes, beginning with "params" or "result", for example
+	// "params.password" or "params.0.token". A "*" matches any single key
+	// or index, for example "result.*.secret".
+	Redact []string
+}
+
+// WithAccessLog returns a HandlerOption that writes a line for each call to
+// l.Writer.
+//
+// Each Request of a batch request is a separate call, as are Notifications
+// and invalid Requests. Errors affecting the whole http.Request, such as a
+// Parse error, are logged as a call with an empty method name.
+//
+// The code is 0 on success, and otherwise the ErrorCode of the Response. The
+// response bytes count the body of the http.Response as written, after any
+// Codec or compression is applied, so all calls of a batch request share the
+// same count. They are 0 for Notifications.
+//
+// The lines for an http.Request are written once its http.Response has been
+// written. Any error writing to l.Writer is logged.
+func WithAccessLog(l AccessLog) HandlerOption {
+	return func(h *handler) {
+		h.access = &accessLog{AccessLog: l, redact: parseRedactPaths(l.Redact)}
+	}
+}
+
+// accessLog writes the lines of an AccessLog.
+type accessLog struct {
+	AccessLog
+	redact [][]string
+
+	mu sync.Mutex
+}
+
+// accessEntry is a single line of an AccessLog.
+type accessEntry struct {
+	Time          time.Time       `json:"time"`
+	RemoteAddr    string          `json:"remote_addr"`
+	Method        string          `json:"method"`
+	ID            json.RawMessage `json:"id,omitempty"`
+	Notification  bool            `json:"notification"`
+	DurationMS    float64         `json:"duration_ms"`
+	Code          ErrorCode       `json:"code"`
+	ResponseBytes int             `json:"response_bytes"`
+	Params        json.RawMessage `json:"params,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+
+	duration time.Duration
+}
+
+// accessCalls holds the entries for the calls of an http.Request until its
+// http.Response has been written.
+type accessCalls struct {
+	mu      sync.Mutex
+	entries []accessEntry
+}
+
+// accessCallsKey is the context.Context key for the *accessCalls of an
+// http.Request.
+type accessCallsKey struct{}
+
+// withCalls returns req with a context.Context carrying a new *accessCalls,
+// which is also returned.
+func (l *accessLog) withCalls(req *http.Request) (*http.Request, *accessCalls) {
+	calls := new(accessCalls)
+	ctx := context.WithValue(req.Context(), accessCallsKey{}, calls)
+	return req.WithContext(ctx), calls
+}
+
+// add adds an entry to the *accessCalls carried by ctx for a call to method
+// with id and params, which started at start and received res, or an empty
+// Response for Notifications.
+func (l *accessLog) add(ctx context.Context, start time.Time, remoteAddr,
+	method string, id, params json.RawMessage, res Response) {
+
+	if l == nil {
+		return
+	}
+	calls, _ := ctx.Value(accessCallsKey{}).(*accessCalls)
+	if calls == nil {
+		return
+	}
+	e := accessEntry{
+		Time:         start,
+		RemoteAddr:   remoteAddr,
+		Method:       method,
+		ID:           id,
+		Notification: res == (Response{}),
+		duration:     time.Since(start),
+	}
+	e.DurationMS = float64(e.duration) / float64(time.Millisecond)
+	if res.HasError() {
+		e.Code = res.Error.Code
+	}
+	if l.Params && params != nil {
+		e.Params = l.redactValue("params", params)
+	}
+	if result, ok := res.Result.(json.RawMessage); l.Result && ok {
+		e.Result = l.redactValue("result", result)
+	}
+
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+	calls.entries = append(calls.entries, e)
+}
+
+// write writes a line for each of the entries in calls, whose http.Response
+// body was n bytes.
+func (l *accessLog) write(log eventLog, calls *accessCalls, n int) {
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+	var lines bytes.Buffer
+	for _, e := range calls.entries {
+		if !e.Notification {
+			e.ResponseBytes = n
+		}
+		if l.Format == AccessLogText {
+			lines.Write(e.text())
+		} else {
+			line, _ := marshalJSON(e) // This cannot cause an error.
+			lines.Write(line)
+		}
+		lines.WriteByte('\n')
+	}
+	if lines.Len() == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := lines.WriteTo(l.Writer); err != nil {
+		log.error("writing access log failed", FieldError, err)
+	}
+}
+
+// countingResponseWriter counts the bytes written to an http.ResponseWriter.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingResponseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.n += n
+	return n, err
+}
+
+// text returns e in the AccessLogText format.
+func (e accessEntry) text() []byte {
+	var b bytes.Buffer
+	id := "-"
+	if !e.Notification {
+		id = "null"
+		if e.ID != nil {
+			id = string(e.ID)
+		}
+	}
+	fmt.Fprintf(&b, "%v [%v] %v %v %v %v %v", e.RemoteAddr,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(e.Method), id, int(e.Code), e.ResponseBytes,
+		e.duration)
+	if e.Params != nil {
+		fmt.Fprintf(&b, " params=%s", e.Params)
+	}
+	if e.Result != nil {
+		fmt.Fprintf(&b, " result=%s", e.Result)
+	}
+	return b.Bytes()
+}
+
+// parseRedactPaths splits each path into its keys.
+func parseRedactPaths(paths []string) [][]string {
+	split := make([][]string, len(paths))
+	for i, path := range paths {
+		split[i] = strings.Split(path, ".")
+	}
+	return split
+}
+
+// redactValue returns data with the value at each of l.redact under root
+// replaced with AccessLogRedacted. The data is returned unmodified if no path
+// is under root, or data is not valid JSON.
+func (l *accessLog) redactValue(root string,
+	data json.RawMessage) json.RawMessage {
+
+	var paths [][]string
+	for _, path := range l.redact {
+		if len(path) > 1 && (path[0] == root || path[0] == "*") {
+			paths = append(paths, path[1:])
+		}
+	}
+	if len(paths) == 0 {
+		return data
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if d.Decode(&v) != nil {
+		return data
+	}
+	for _, path := range paths {
+		v = redactPath(v, path)
+	}
+	redacted, err := marshalJSON(v)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactPath replaces the value at path within v with AccessLogRedacted.
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return AccessLogRedacted
+	}
+	key, rest := path[0], path[1:]
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if key == "*" || key == k {
+				v[k] = redactPath(elem, rest)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if key == "*" || key == strconv.Itoa(i) {
+				v[i] = redactPath(elem, rest)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// accessTestMethods echo their params.
+var accessTestMethods = MethodMap{
+	"echo": func(_ context.Context, params json.RawMessage) interface{} {
+		return params
+	},
+	"fail": func(context.Context, json.RawMessage) interface{} {
+		return NewError(1, "fail", nil)
+	},
+}
+
+func TestWithAccessLog(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	h := HTTPRequestHandler(accessTestMethods, nil,
+		WithAccessLog(AccessLog{Writer: &buf}))
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`[{"jsonrpc":"2.0","method":"echo","params":[1],"id":1},
+			{"jsonrpc":"2.0","method":"fail","id":"a"},
+			{"jsonrpc":"2.0","method":"echo"},
+			{"jsonrpc":"2.0","id":2}]`))
+	w := httptest.NewRecorder()
+	h(w, req)
+
+	var ress []json.RawMessage
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &ress))
+	assert.Len(ress, 3)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(lines, 4) {
+		return
+	}
+	type entry struct {
+		RemoteAddr    string          `json:"remote_addr"`
+		Method        string          `json:"method"`
+		ID            json.RawMessage `json:"id"`
+		Notification  bool            `json:"notification"`
+		DurationMS    *float64        `json:"duration_ms"`
+		Code          ErrorCode       `json:"code"`
+		ResponseBytes int             `json:"response_bytes"`
+		Params        json.RawMessage `json:"params"`
+		Result        json.RawMessage `json:"result"`
+	}
+	entries := make([]entry, len(lines))
+	for i, line := range lines {
+		assert.NoError(json.Unmarshal([]byte(line), &entries[i]))
+		assert.Equal(req.RemoteAddr, entries[i].RemoteAddr)
+		assert.NotNil(entries[i].DurationMS)
+		assert.Nil(entries[i].Params)
+		assert.Nil(entries[i].Result)
+	}
+	assert.Equal("echo", entries[0].Method)
+	assert.Equal(json.RawMessage(`1`), entries[0].ID)
+	assert.False(entries[0].Notification)
+	assert.Equal(ErrorCode(0), entries[0].Code)
+	assert.Equal(w.Body.Len(), entries[0].ResponseBytes)
+
+	assert.Equal(json.RawMessage(`"a"`), entries[1].ID)
+	assert.Equal(ErrorCode(1), entries[1].Code)
+	assert.Equal(w.Body.Len(), entries[1].ResponseBytes)
+
+	assert.True(entries[2].Notification)
+	assert.Nil(entries[2].ID)
+	assert.Equal(0, entries[2].ResponseBytes)
+
+	assert.Equal(ErrorCodeInvalidRequest, entries[3].Code)
+	assert.Equal(w.Body.Len(), entries[3].ResponseBytes)
+
+	// Errors affecting the whole http.Request are logged too.
+	buf.Reset()
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`{`)))
+	var e entry
+	assert.NoError(json.Unmarshal(buf.Bytes(), &e))
+	assert.Equal(ErrorCodeParse, e.Code)
+	assert.Equal("", e.Method)
+}
+
+func TestAccessLogText(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	h := HTTPRequestHandler(accessTestMethods, nil,
+		WithAccessLog(AccessLog{
+			Writer: &buf,
+			Format: AccessLogText,
+			Params: true,
+			Result: true,
+			Redact: []string{"params.password", "result.*.token",
+				"params.0"},
+		}))
+
+	serve := func(body string) string {
+		buf.Reset()
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost,
+			"/", strings.NewReader(body)))
+		return buf.String()
+	}
+
+	line := serve(`{"jsonrpc":"2.0","method":"echo","id":1,
+		"params":{"user":"a","password":"b","keys":[{"token":"c","n":1.50}]}}`)
+	assert.Regexp(`^192\.0\.2\.1:1234 \[\d\d/\w\w\w/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}\] "echo" 1 0 \d+ \S+ `, line)
+	assert.Contains(line,
+		` params={"keys":[{"n":1.50,"token":"c"}],"password":"[REDACTED]","user":"a"}`)
+	assert.Contains(line,
+		` result={"keys":[{"n":1.50,"token":"c"}],"password":"b","user":"a"}`)
+
+	line = serve(`{"jsonrpc":"2.0","method":"echo","id":1,
+		"params":{"keys":{"x":{"token":"c"}}}}`)
+	assert.Contains(line, ` result={"keys":{"x":{"token":"c"}}}`)
+
+	line = serve(`{"jsonrpc":"2.0","method":"echo","id":1,
+		"params":["secret",{"token":"c"}]}`)
+	assert.Contains(line, ` params=["[REDACTED]",{"token":"c"}]`)
+	assert.Contains(line, ` result=["secret",{"token":"[REDACTED]"}]`)
+
+	line = serve(`{"jsonrpc":"2.0","method":"echo","params":[1]}`)
+	assert.Regexp(`"echo" - 0 0 \S+ params=\["\[REDACTED\]"\]`+"\n$", line)
+
+	line = serve(`{"jsonrpc":"2.0","method":"fail","id":null}`)
+	assert.Regexp(`"fail" null 1 \d+ \S+`+"\n$", line)
+}
+
+func TestAccessLogCompressed(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	h := HTTPRequestHandler(compressTestMethods, nil,
+		WithAccessLog(AccessLog{Writer: &buf}),
+		WithCompression(Compression{MinBytes: 1}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+		`{"jsonrpc":"2.0","method":"repeat","params":{"S":"a","N":1000},"id":1}`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h(w, req)
+	assert.Equal("gzip", w.Header().Get("Content-Encoding"))
+
+	// The bytes written are counted, after compression.
+	var e struct {
+		ResponseBytes int `json:"response_bytes"`
+	}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &e))
+	assert.Equal(w.Body.Len(), e.ResponseBytes)
+	assert.Less(e.ResponseBytes, 1000)
+}
@@ -0,0 +1,253 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed allows all requests.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails all requests fast with an ErrorCircuitOpen.
+	BreakerOpen
+
+	// BreakerHalfOpen allows a single trial request. If it succeeds the
+	// circuit is closed, otherwise it is opened again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState{%v}", int(s))
+}
+
+// BreakerKey identifies a circuit of a CircuitBreaker. The Method is empty
+// unless CircuitBreaker.PerMethod is true.
+type BreakerKey struct {
+	URL    string
+	Method string
+}
+
+// ErrorCircuitOpen is returned by the Client without making a request while
+// the circuit for the BreakerKey is open.
+type ErrorCircuitOpen struct {
+	BreakerKey
+
+	// Until is when the circuit becomes half-open.
+	Until time.Time
+}
+
+// Error implements the error interface.
+func (err ErrorCircuitOpen) Error() string {
+	if err.Method == "" {
+		return fmt.Sprintf("jsonrpc2: circuit open for %v", err.URL)
+	}
+	return fmt.Sprintf("jsonrpc2: circuit open for %v %q", err.URL, err.Method)
+}
+
+// CircuitBreaker fails requests fast while an endpoint, or a method of an
+// endpoint, is failing.
+//
+// A circuit is opened after FailureThreshold consecutive failures. Transport
+// errors and ErrorUnexpectedHTTPResponse count as failures. Error Responses do
+// not, since they show that the endpoint is able to respond. After
+// OpenTimeout, the circuit is half-open and allows a single trial request,
+// which either closes or reopens the circuit.
+//
+// Set Client.Breaker to use a CircuitBreaker. A CircuitBreaker may be shared
+// by multiple Clients and must not be copied after first use.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that open a
+	// circuit. If zero, 1 is used.
+	FailureThreshold int
+
+	// OpenTimeout is how long a circuit stays open before becoming
+	// half-open.
+	OpenTimeout time.Duration
+
+	// PerMethod tracks a separate circuit for each method of each
+	// endpoint, instead of a single circuit for each endpoint.
+	PerMethod bool
+
+	// OnStateChange, if not nil, is called whenever the state of a circuit
+	// changes. It must not call any methods of the CircuitBreaker.
+	OnStateChange func(key BreakerKey, from, to BreakerState)
+
+	mu       sync.Mutex
+	circuits map[BreakerKey]*circuit
+}
+
+// circuit is the state of a single circuit.
+type circuit struct {
+	state     BreakerState
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// State returns the state of the circuit for url and method. The method is
+// ignored unless cb.PerMethod is true.
+func (cb *CircuitBreaker) State(url, method string) BreakerState {
+	if cb == nil {
+		return BreakerClosed
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[cb.key(url, method)]
+	if !ok {
+		return BreakerClosed
+	}
+	return c.current(time.Now())
+}
+
+// States returns the state of every circuit that has had a request.
+func (cb *CircuitBreaker) States() map[BreakerKey]BreakerState {
+	if cb == nil {
+		return nil
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := time.Now()
+	states := make(map[BreakerKey]BreakerState, len(cb.circuits))
+	for key, c := range cb.circuits {
+		states[key] = c.current(now)
+	}
+	return states
+}
+
+// allow returns an ErrorCircuitOpen if a request to url for method must fail
+// fast. Otherwise the request may be made and its outcome must be passed to
+// cb.record along with the returned trial, which is true if the request is
+// the trial request of a half-open circuit.
+func (cb *CircuitBreaker) allow(url, method string) (trial bool, err error) {
+	if cb == nil {
+		return false, nil
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	key := cb.key(url, method)
+	c := cb.circuit(key)
+	now := time.Now()
+	switch c.current(now) {
+	case BreakerOpen:
+		return false, ErrorCircuitOpen{key, c.openUntil}
+	case BreakerHalfOpen:
+		if c.trial {
+			return false, ErrorCircuitOpen{key, c.openUntil}
+		}
+		cb.setState(key, c, BreakerHalfOpen)
+		c.trial = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record the outcome of a request allowed by cb.allow, which returned err.
+// The trial must be the value returned by cb.allow. Requests that ended
+// because ctx is done do not affect the circuit. Once the circuit has opened,
+// only the outcome of its trial request does.
+func (cb *CircuitBreaker) record(ctx context.Context,
+	url, method string, trial bool, err error) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	key := cb.key(url, method)
+	c := cb.circuit(key)
+	if trial {
+		c.trial = false
+	}
+	if ctx != nil && ctx.Err() != nil || c.state != BreakerClosed && !trial {
+		return
+	}
+	if !isEndpointFailure(ctx, err) {
+		c.failures = 0
+		cb.setState(key, c, BreakerClosed)
+		return
+	}
+	c.failures++
+	threshold := cb.FailureThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	if c.state == BreakerHalfOpen || c.failures >= threshold {
+		c.failures = 0
+		c.openUntil = time.Now().Add(cb.OpenTimeout)
+		cb.setState(key, c, BreakerOpen)
+	}
+}
+
+// key returns the BreakerKey for url and method.
+func (cb *CircuitBreaker) key(url, method string) BreakerKey {
+	if !cb.PerMethod {
+		method = ""
+	}
+	return BreakerKey{url, method}
+}
+
+// circuit returns the circuit for key, creating it if needed. The cb.mu must
+// be held.
+func (cb *CircuitBreaker) circuit(key BreakerKey) *circuit {
+	if cb.circuits == nil {
+		cb.circuits = make(map[BreakerKey]*circuit)
+	}
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = new(circuit)
+		cb.circuits[key] = c
+	}
+	return c
+}
+
+// setState sets the state of c and calls cb.OnStateChange if it changed. The
+// cb.mu must be held.
+func (cb *CircuitBreaker) setState(key BreakerKey, c *circuit, state BreakerState) {
+	from := c.state
+	c.state = state
+	if from != state && cb.OnStateChange != nil {
+		cb.OnStateChange(key, from, state)
+	}
+}
+
+// current returns the state of c at now, which is half-open if c is open but
+// its OpenTimeout has elapsed.
+func (c *circuit) current(now time.Time) BreakerState {
+	if c.state == BreakerOpen && !now.Before(c.openUntil) {
+		return BreakerHalfOpen
+	}
+	return c.state
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var down bool
+	h := HTTPRequestHandler(MethodMap{
+		"ok": func(context.Context, json.RawMessage) interface{} {
+			return true
+		}}, nil)
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if down {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			h(w, req)
+		}))
+	defer srv.Close()
+
+	var changes []BreakerState
+	cb := &CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Hour,
+		OnStateChange: func(_ BreakerKey, _, to BreakerState) {
+			changes = append(changes, to)
+		},
+	}
+	c := Client{Breaker: cb}
+	key := BreakerKey{URL: srv.URL}
+
+	assert.NoError(c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerClosed, cb.State(srv.URL, "ok"))
+
+	down = true
+	assert.IsType(ErrorUnexpectedHTTPResponse{}, c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerClosed, cb.State(srv.URL, "ok"))
+	assert.IsType(ErrorUnexpectedHTTPResponse{}, c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerOpen, cb.State(srv.URL, "ok"))
+	assert.Equal(map[BreakerKey]BreakerState{key: BreakerOpen}, cb.States())
+
+	// Fail fast while open, even once the endpoint is back up.
+	down = false
+	err := c.Request(nil, srv.URL, "ok", nil, nil)
+	if assert.IsType(ErrorCircuitOpen{}, err) {
+		assert.Equal(key, err.(ErrorCircuitOpen).BreakerKey)
+	}
+	assert.Error(c.Notify(nil, srv.URL, "ok", nil))
+
+	// A failed trial request reopens the circuit.
+	cb.circuits[key].openUntil = time.Now()
+	assert.Equal(BreakerHalfOpen, cb.State(srv.URL, "ok"))
+	down = true
+	assert.IsType(ErrorUnexpectedHTTPResponse{}, c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerOpen, cb.State(srv.URL, "ok"))
+
+	// A successful trial request closes the circuit.
+	cb.circuits[key].openUntil = time.Now()
+	down = false
+	assert.NoError(c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerClosed, cb.State(srv.URL, "ok"))
+
+	assert.Equal([]BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen,
+		BreakerHalfOpen, BreakerClosed}, changes)
+
+	// Circuits are tracked separately for each method if PerMethod.
+	cb = &CircuitBreaker{PerMethod: true, OpenTimeout: time.Hour}
+	c.Breaker = cb
+	down = true
+	assert.Error(c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal(BreakerOpen, cb.State(srv.URL, "ok"))
+	assert.Equal(BreakerClosed, cb.State(srv.URL, "other"))
+}
+
+func TestCircuitBreakerStaleRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	cb := &CircuitBreaker{OpenTimeout: time.Hour}
+	failure := ErrorUnexpectedHTTPResponse{}
+
+	// A request is in flight while another one opens the circuit.
+	stale, err := cb.allow("url", "")
+	assert.NoError(err)
+	assert.False(stale)
+	trial, err := cb.allow("url", "")
+	assert.NoError(err)
+	cb.record(nil, "url", "", trial, failure)
+	assert.Equal(BreakerOpen, cb.State("url", ""))
+
+	// Once half-open, a stale success neither closes the circuit nor
+	// clears the trial.
+	cb.circuits[BreakerKey{URL: "url"}].openUntil = time.Now()
+	trial, err = cb.allow("url", "")
+	assert.NoError(err)
+	assert.True(trial)
+	cb.record(nil, "url", "", stale, nil)
+	assert.Equal(BreakerHalfOpen, cb.State("url", ""))
+	_, err = cb.allow("url", "")
+	assert.IsType(ErrorCircuitOpen{}, err)
+
+	// Only the outcome of the trial request affects the circuit.
+	cb.record(nil, "url", "", trial, failure)
+	assert.Equal(BreakerOpen, cb.State("url", ""))
+}
+
+func TestBreakerStateString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("closed", BreakerClosed.String())
+	assert.Equal("open", BreakerOpen.String())
+	assert.Equal("half-open", BreakerHalfOpen.String())
+	assert.Equal("BreakerState{5}", BreakerState(5).String())
+}
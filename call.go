@@ -0,0 +1,131 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+)
+
+// Call represents an asynchronous Request started by Client.Go.
+//
+// The Call is sent on Done once it is complete, at which point Error and
+// Result are populated.
+type Call struct {
+	URL    string
+	Method string
+	Params interface{}
+
+	// Result is populated with the Response "result" on success, as for
+	// Client.Request.
+	Result interface{}
+
+	// Error is set after the Call is complete. See Client.Request for the
+	// possible errors.
+	Error error
+
+	// Done receives the Call once it is complete.
+	Done chan *Call
+
+	cancel   context.CancelFunc
+	finished chan struct{}
+}
+
+// Go starts a Request to url with the given method and params in a new
+// goroutine, and returns a Call representing it. See Client.Request for
+// details.
+//
+// The done channel receives the Call once it is complete. If done is nil, a
+// new channel is allocated. Otherwise, done must be buffered, so that many
+// Calls may share it, or Go will panic. If done is full when the Call
+// completes, the Call is not sent on it, but Call.Wait still returns.
+//
+// The Request is made with the same settings as c.Request, including ID
+// generation, retries and any CircuitBreaker.
+func (c *Client) Go(ctx context.Context, url, method string,
+	params, result interface{}, done chan *Call) *Call {
+
+	// Set any default c.Log now, rather than in the new goroutine, where
+	// it would race with any other Calls.
+	c.initLog()
+	call := &Call{URL: url, Method: method, Params: params, Result: result}
+	call.start(ctx, done, func(ctx context.Context) error {
+		return c.Request(ctx, url, method, params, result)
+	})
+	return call
+}
+
+// Go starts a Request to one of mc.Endpoints in a new goroutine, and returns a
+// Call representing it. See Client.Go and MultiClient.Request for details.
+//
+// The URL of the returned Call is empty, since the endpoint is selected for
+// each attempt.
+func (mc *MultiClient) Go(ctx context.Context, method string,
+	params, result interface{}, done chan *Call) *Call {
+
+	mc.initLog()
+	call := &Call{Method: method, Params: params, Result: result}
+	call.start(ctx, done, func(ctx context.Context) error {
+		return mc.Request(ctx, method, params, result)
+	})
+	return call
+}
+
+// start runs request in a new goroutine with a cancelable child of ctx, and
+// sends call on done once it returns.
+func (call *Call) start(ctx context.Context, done chan *Call,
+	request func(context.Context) error) {
+
+	if done == nil {
+		done = make(chan *Call, 1)
+	} else if cap(done) == 0 {
+		panic("jsonrpc2: Go: done channel is unbuffered")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, call.cancel = context.WithCancel(ctx)
+	call.Done = done
+	call.finished = make(chan struct{})
+	go func() {
+		call.Error = request(ctx)
+		call.cancel()
+		close(call.finished)
+		select {
+		case call.Done <- call:
+		default:
+			// Do not block if done is full, Wait still returns.
+		}
+	}()
+}
+
+// Wait blocks until the Call is complete and returns call.Error.
+//
+// Wait does not receive from call.Done, so both may be used.
+func (call *Call) Wait() error {
+	<-call.finished
+	return call.Error
+}
+
+// Cancel cancels the context of the Call. The Call is still sent on Done once
+// it returns, usually with an error wrapping context.Canceled.
+func (call *Call) Cancel() {
+	call.cancel()
+}
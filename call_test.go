@@ -0,0 +1,112 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientGo(t *testing.T) {
+	assert := assert.New(t)
+
+	block := make(chan struct{})
+	srv := httptest.NewServer(HTTPRequestHandler(MethodMap{
+		"double": func(_ context.Context, params json.RawMessage) interface{} {
+			var x []int
+			if err := json.Unmarshal(params, &x); err != nil || len(x) != 1 {
+				return ErrorInvalidParams(nil)
+			}
+			return 2 * x[0]
+		},
+		"block": func(ctx context.Context, _ json.RawMessage) interface{} {
+			select {
+			case <-block:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	}, nil))
+	defer srv.Close()
+	defer close(block)
+
+	var c Client
+
+	// Fan out using a shared done channel.
+	done := make(chan *Call, 5)
+	results := make([]int, 5)
+	for i := range results {
+		c.Go(nil, srv.URL, "double", []int{i}, &results[i], done)
+	}
+	for range results {
+		call := <-done
+		assert.NoError(call.Error)
+		assert.Equal(srv.URL, call.URL)
+		assert.Equal("double", call.Method)
+	}
+	assert.Equal([]int{0, 2, 4, 6, 8}, results)
+
+	// Wait and the allocated Done channel can both be used.
+	var result int
+	call := c.Go(nil, srv.URL, "double", []int{5}, &result, nil)
+	assert.NoError(call.Wait())
+	assert.Equal(10, result)
+	assert.Equal(call, <-call.Done)
+
+	call = c.Go(nil, srv.URL, "double", nil, nil, nil)
+	assert.Equal(ErrorInvalidParams(nil), call.Wait())
+
+	// Cancel a blocked Call.
+	call = c.Go(context.Background(), srv.URL, "block", nil, nil, nil)
+	call.Cancel()
+	assert.True(errors.Is(call.Wait(), context.Canceled))
+
+	assert.Panics(func() {
+		c.Go(nil, srv.URL, "double", nil, nil, make(chan *Call))
+	})
+}
+
+func TestClientGoDebugRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(HTTPRequestHandler(MethodMap{
+		"ok": func(context.Context, json.RawMessage) interface{} {
+			return true
+		}}, nil))
+	defer srv.Close()
+
+	// The default c.Log is set by Go, and not by the Calls running
+	// concurrently.
+	c := Client{DebugRequest: true}
+	done := make(chan *Call, 5)
+	for i := 0; i < cap(done); i++ {
+		c.Go(nil, srv.URL, "ok", nil, nil, done)
+		assert.NotNil(c.Log)
+	}
+	for i := 0; i < cap(done); i++ {
+		assert.NoError((<-done).Error)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// CBORCodec is a Codec for CBOR, with the media type "application/cbor". See
+// RFC 8949.
+//
+// Byte strings are converted to a base64 encoded JSON String, tags are
+// ignored, and undefined is converted to null. Map keys that are not text
+// strings, and simple values other than false, true, null and undefined, are
+// not supported.
+var CBORCodec Codec = cborCodec{}
+
+type cborCodec struct{}
+
+// ContentType returns "application/cbor".
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+// FromJSON converts the JSON in data to CBOR.
+func (cborCodec) FromJSON(data []byte) ([]byte, error) {
+	b, err := fromJSON(cborWriter{}, data)
+	if err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	return b, nil
+}
+
+// ToJSON converts the CBOR in data to JSON.
+func (cborCodec) ToJSON(data []byte) ([]byte, error) {
+	r := cborReader{binaryReader{data: data}}
+	var b bytes.Buffer
+	if err := r.value(&b); err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("cbor: %v bytes after top level value",
+			len(r.data))
+	}
+	return b.Bytes(), nil
+}
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborIndefinite is the additional information for an indefinite length.
+const cborIndefinite = 31
+
+// cborBreak terminates an indefinite length item.
+const cborBreak = 0xff
+
+// cborWriter writes the preferred CBOR encoding of each value.
+type cborWriter struct{}
+
+func (cborWriter) writeNull(b *bytes.Buffer) {
+	b.WriteByte(0xf6)
+}
+
+func (cborWriter) writeBool(b *bytes.Buffer, v bool) {
+	if v {
+		b.WriteByte(0xf5)
+	} else {
+		b.WriteByte(0xf4)
+	}
+}
+
+func (cborWriter) writeInt(b *bytes.Buffer, v int64) {
+	if v >= 0 {
+		writeCBORHead(b, cborUint, uint64(v))
+		return
+	}
+	writeCBORHead(b, cborNegInt, uint64(-1-v))
+}
+
+func (cborWriter) writeUint(b *bytes.Buffer, v uint64) {
+	writeCBORHead(b, cborUint, v)
+}
+
+func (cborWriter) writeFloat(b *bytes.Buffer, v float64) {
+	if f := float32(v); float64(f) == v {
+		writeBigEndian(b, cborSimple<<5|26, uint64(math.Float32bits(f)), 4)
+		return
+	}
+	writeBigEndian(b, cborSimple<<5|27, math.Float64bits(v), 8)
+}
+
+func (cborWriter) writeString(b *bytes.Buffer, v string) {
+	writeCBORHead(b, cborText, uint64(len(v)))
+	b.WriteString(v)
+}
+
+func (cborWriter) writeArray(b *bytes.Buffer, n int) {
+	writeCBORHead(b, cborArray, uint64(n))
+}
+
+func (cborWriter) writeMap(b *bytes.Buffer, n int) {
+	writeCBORHead(b, cborMap, uint64(n))
+}
+
+// writeCBORHead writes the shortest head for the major type and argument n.
+func writeCBORHead(b *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		b.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		b.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		writeBigEndian(b, major|25, n, 2)
+	case n <= math.MaxUint32:
+		writeBigEndian(b, major|26, n, 4)
+	default:
+		writeBigEndian(b, major|27, n, 8)
+	}
+}
+
+// cborReader converts CBOR data items to JSON.
+type cborReader struct {
+	binaryReader
+}
+
+// head reads the head of the next data item and returns its major type,
+// additional information, and argument, unless info is cborIndefinite.
+func (r *cborReader) head() (major, info byte, n uint64, _ error) {
+	c, err := r.uint(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = byte(c>>5), byte(c&0x1f)
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		n, err := r.uint(1 << (info - 24))
+		return major, info, n, err
+	case info == cborIndefinite && major >= cborBytes && major <= cborMap:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("invalid additional information %v "+
+		"for major type %v", info, major)
+}
+
+// value converts the next data item to JSON and writes it to b.
+func (r *cborReader) value(b *bytes.Buffer) error {
+	major, info, n, err := r.head()
+	if err != nil {
+		return err
+	}
+	indefinite := info == cborIndefinite
+	switch major {
+	case cborUint:
+		b.WriteString(strconv.FormatUint(n, 10))
+	case cborNegInt:
+		// The value is -1 - n, which may be less than math.MinInt64.
+		if n == math.MaxUint64 {
+			b.WriteString("-18446744073709551616")
+		} else {
+			b.WriteString("-" + strconv.FormatUint(n+1, 10))
+		}
+	case cborBytes:
+		data, err := r.string(major, n, indefinite)
+		if err != nil {
+			return err
+		}
+		writeJSONBytes(b, data)
+	case cborText:
+		data, err := r.string(major, n, indefinite)
+		if err != nil {
+			return err
+		}
+		writeJSONString(b, string(data))
+	case cborArray:
+		return r.array(b, n, indefinite)
+	case cborMap:
+		return r.object(b, n, indefinite)
+	case cborTag:
+		// Tags only add semantics to the enclosed data item.
+		if err := r.enter(); err != nil {
+			return err
+		}
+		defer r.exit()
+		return r.value(b)
+	case cborSimple:
+		return writeCBORSimple(b, info, n)
+	}
+	return nil
+}
+
+// writeCBORSimple writes the simple value or float with the additional
+// information info and argument n to b as JSON.
+func writeCBORSimple(b *bytes.Buffer, info byte, n uint64) error {
+	switch info {
+	case 20:
+		b.WriteString("false")
+	case 21:
+		b.WriteString("true")
+	case 22, 23: // null, undefined
+		b.WriteString("null")
+	case 25:
+		return writeJSONFloat(b, halfToFloat64(uint16(n)))
+	case 26:
+		return writeJSONFloat(b, float64(math.Float32frombits(uint32(n))))
+	case 27:
+		return writeJSONFloat(b, math.Float64frombits(n))
+	default:
+		return fmt.Errorf("unsupported simple value %v", n)
+	}
+	return nil
+}
+
+// halfToFloat64 converts an IEEE 754 half precision float to a float64.
+func halfToFloat64(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+0x400, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// string returns the contents of a byte or text string of the major type
+// with length n, or the concatenation of its chunks if indefinite is true.
+func (r *cborReader) string(major byte, n uint64,
+	indefinite bool) ([]byte, error) {
+
+	if !indefinite {
+		return r.next(n)
+	}
+	var data []byte
+	for !r.atBreak() {
+		chunkMajor, info, n, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || info == cborIndefinite {
+			return nil, fmt.Errorf("invalid indefinite length string chunk")
+		}
+		chunk, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	return data, r.readBreak()
+}
+
+// array converts an array of n data items, or until a break if indefinite is
+// true, to a JSON Array.
+func (r *cborReader) array(b *bytes.Buffer, n uint64, indefinite bool) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	b.WriteByte('[')
+	for i := uint64(0); indefinite && !r.atBreak() || i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := r.value(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(']')
+	if indefinite {
+		return r.readBreak()
+	}
+	return nil
+}
+
+// object converts a map of n pairs of data items, or until a break if
+// indefinite is true, to a JSON Object.
+func (r *cborReader) object(b *bytes.Buffer, n uint64, indefinite bool) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	b.WriteByte('{')
+	for i := uint64(0); indefinite && !r.atBreak() || i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if len(r.data) > 0 && r.data[0]>>5 != cborText {
+			return fmt.Errorf("unsupported map key major type %v",
+				r.data[0]>>5)
+		}
+		if err := r.value(b); err != nil {
+			return err
+		}
+		b.WriteByte(':')
+		if err := r.value(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	if indefinite {
+		return r.readBreak()
+	}
+	return nil
+}
+
+// atBreak returns true if the next byte is a break.
+func (r *cborReader) atBreak() bool {
+	return len(r.data) > 0 && r.data[0] == cborBreak
+}
+
+// readBreak consumes a break.
+func (r *cborReader) readBreak() error {
+	if !r.atBreak() {
+		return errUnexpectedEnd
+	}
+	r.data = r.data[1:]
+	return nil
+}
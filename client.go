@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -32,8 +33,11 @@ import (
 	"os"
 )
 
-// Logger allows custom log types to be used with the Client when
-// Client.DebugRequest is true.
+// Logger allows custom log types, such as a *log.Logger, to be used with the
+// Client when Client.DebugRequest is true, and with the HTTPRequestHandler.
+//
+// All logging is done using an EventLogger. A Logger is adapted using
+// NewEventLogger.
 type Logger interface {
 	Println(...interface{})
 	Printf(string, ...interface{})
@@ -73,6 +77,71 @@ type Client struct {
 	User      string
 	Password  string
 	Header    http.Header
+
+	// Retry is the RetryPolicy used for any method not in MethodRetry.
+	// The zero value never retries.
+	Retry RetryPolicy
+
+	// MethodRetry overrides Retry for the given method names.
+	MethodRetry map[string]RetryPolicy
+
+	// NonIdempotent methods are never retried, regardless of any
+	// RetryPolicy.
+	NonIdempotent map[string]bool
+
+	// Breaker, if not nil, fails requests fast with an ErrorCircuitOpen
+	// while an endpoint is failing.
+	Breaker *CircuitBreaker
+
+	// DecodePolicy controls which deviations from the Spec are tolerated
+	// in Responses. The zero value is strict.
+	DecodePolicy DecodePolicy
+
+	// Version1 sends Requests and Notifications in JSON-RPC 1.0 format,
+	// which omits "jsonrpc", requires any params to marshal into an
+	// array, and uses a null "id" for Notifications. JSON-RPC 1.0
+	// Responses, which omit "jsonrpc", are also accepted, as are JSON-RPC
+	// 2.0 Responses.
+	Version1 bool
+
+	// Codec, if not nil, is used to encode the http.Request body, and is
+	// preferred for the http.Response body using the Accept header. The
+	// http.Response body is converted using Codec only if its
+	// Content-Type matches, and is otherwise assumed to be JSON.
+	Codec Codec
+
+	// Compression, if not nil, gzip compresses http.Request bodies of at
+	// least Compression.MinBytes. The server must support a
+	// Content-Encoding of gzip, for example by using WithCompression.
+	//
+	// Regardless of Compression, gzip and deflate are accepted for
+	// http.Response bodies, which are transparently decompressed.
+	Compression *Compression
+
+	// Metrics, if not nil, is reported each Request and Notification,
+	// including all retries, and its outcome.
+	Metrics Metrics
+
+	// Errors, if not nil, is used to return typed errors for Errors with
+	// a registered ErrorCode. The "data" of the Error is decoded into a
+	// new value of the registered Type, which is returned as the error,
+	// and may be retrieved using errors.As. The Error itself can also
+	// still be retrieved using errors.As. If the "data" cannot be
+	// decoded, the Error is returned.
+	Errors *ErrorRegistry
+
+	// EventLog, if not nil, receives the debug Events logged when
+	// DebugRequest is true, instead of Log.
+	EventLog EventLogger
+
+	// Tracer, if not nil, starts a Span for each Request and
+	// Notification, including all retries, as a child of any
+	// TraceContext carried by the context.Context.
+	//
+	// Regardless of Tracer, any TraceContext carried by the
+	// context.Context is sent in the "traceparent" and "tracestate"
+	// headers.
+	Tracer Tracer
 }
 
 // Request uses c to make a JSON-RPC 2.0 Request to url with the given method
@@ -86,50 +155,274 @@ type Client struct {
 // Unmarshaling error, the raw bytes of the http.Response.Body, and the
 // http.Response.
 //
-// If the Response.HasError() is true, then the Error is returned.
+// If the Response.HasError() is true, then the Error is returned, or a typed
+// error if the ErrorCode is registered in c.Errors.
 //
 // Other potential errors can result from json.Marshal and params,
 // http.NewRequest and url, or network errors from c.Do.
 //
-// A pseudorandom uint between 1 and 5000 is used for the Request.ID.
+// If c.Breaker is not nil and the circuit for url is open, an ErrorCircuitOpen
+// is returned without making a request.
+//
+// Failed attempts are retried according to the RetryPolicy for the method.
+// See Client.Retry, Client.MethodRetry and Client.NonIdempotent. The same
+// Request.ID is used for all attempts.
+//
+// A pseudorandom uint between 1 and 5000 is used for the Request.ID. If the
+// Response "id" is not exactly the same as the Request ID, an
+// ErrorUnexpectedHTTPResponse is returned. A null "id" is only accepted with
+// an Error, since a server may not be able to determine the Request ID.
 //
 // The "Content-Type":"application/json" header is added to the http.Request,
-// and then headers in c.Header are added, which may override the
-// "Content-Type".
+// or the media type of c.Codec along with an "Accept" header, as well as an
+// "Accept-Encoding" header for gzip and deflate. Then headers in c.Header are
+// added, which may override these.
 //
 // If c.BasicAuth is true then http.Request.SetBasicAuth(c.User, c.Password) is
 // be called.
 //
-// If c.DebugRequest is true then the Request and Response are printed using
-// c.Log. If c.Log == nil, then c.Log = log.New(os.Stderr, "", 0).
+// If c.DebugRequest is true then the Request and Response are logged to
+// c.EventLog, or if it is nil, printed using c.Log. If c.Log == nil, then
+// c.Log = log.New(os.Stderr, "", 0).
+//
+// If c.Metrics is not nil, the Request is reported to it once, regardless of
+// any retries. Likewise, if c.Tracer is not nil, a single Span is started.
 func (c *Client) Request(ctx context.Context, url, method string,
 	params, result interface{}) error {
 
-	// Generate a psuedo random ID for this request.
-	reqID := rand.Int()%5000 + 1
+	return c.retryRequest(ctx, method, params,
+		func(ctx context.Context, id ID, reqData []byte) error {
+			return c.request(ctx, url, method, id, reqData, result)
+		})
+}
+
+// retryRequest marshals a new Request for method and params, and makes
+// attempts to send it using do, according to the RetryPolicy for method.
+// The Request is reported to c.Metrics once, regardless of any retries, and
+// do is called with the context.Context of a single Span from c.Tracer.
+func (c *Client) retryRequest(ctx context.Context, method string,
+	params interface{},
+	do func(ctx context.Context, id ID, reqData []byte) error) (err error) {
+
+	m := metricsHook{c.Metrics}
+	start := m.started(method)
+	defer func() { m.finished(method, err, start) }()
 
 	// Marshal the JSON RPC Request.
-	req := Request{ID: reqID, Method: method, Params: params}
+	req := newRequest(method, params)
+	reqData, err := c.marshalRequest(req)
+	if err != nil {
+		return err
+	}
+
+	id := req.ID.(ID)
+	ctx, span := c.startSpan(ctx, method, id)
+	defer func() { span.End(err) }()
+
+	retry := c.retryPolicy(method)
+	for attempt := 1; ; attempt++ {
+		err = do(ctx, id, reqData)
+		if !retry.wait(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+// Notify uses c to send a JSON-RPC 2.0 Notification to url with the given
+// method and params. Any http.Response.Body is discarded, since the server
+// does not respond to Notifications.
+//
+// Notifications are never retried, since there is no Response to indicate
+// whether the method was invoked.
+//
+// Potential errors can result from json.Marshal and params, http.NewRequest
+// and url, or network errors from c.Do.
+//
+// See Client.Request for details about the headers and debug output.
+func (c *Client) Notify(ctx context.Context, url, method string,
+	params interface{}) (err error) {
+
+	m := metricsHook{c.Metrics}
+	start := m.started(method)
+	defer func() { m.finished(method, err, start) }()
+	ctx, span := c.startSpan(ctx, method, ID{})
+	defer func() { span.End(err) }()
+
+	reqData, err := c.marshalRequest(Request{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	trial, err := c.Breaker.allow(url, method)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.post(ctx, url, reqData)
+	c.Breaker.record(ctx, url, method, trial, err)
+	return err
+}
+
+// startSpan starts a Span for a call to method using c.Tracer. The id is Null
+// for Notifications.
+func (c *Client) startSpan(ctx context.Context, method string,
+	id ID) (context.Context, Span) {
+
+	ctx, span := traceHook{c.Tracer}.start(ctx, method, SpanClient)
+	span.SetAttribute(AttributeMethod, method)
+	if !id.IsNull() {
+		span.SetAttribute(AttributeRequestID, id.String())
+	}
+	return ctx, span
+}
+
+// newRequest returns a Request for method and params with a psuedo random ID.
+func newRequest(method string, params interface{}) Request {
+	reqID := Int64ID(int64(rand.Int()%5000 + 1))
+	return Request{ID: reqID, Method: method, Params: params}
+}
+
+// marshalRequest marshals req, in JSON-RPC 1.0 format if c.Version1 is true,
+// and logs it if c.DebugRequest is true.
+func (c *Client) marshalRequest(req Request) ([]byte, error) {
+	req.version1 = c.Version1
+	data, err := req.MarshalJSON()
 	if c.DebugRequest {
-		if c.Log == nil {
-			c.Log = log.New(os.Stderr, "", 0)
+		kvs := []interface{}{FieldMethod, req.Method}
+		if req.ID != nil {
+			kvs = append(kvs, FieldID, req.ID)
 		}
-		c.Log.Println(req)
+		if err != nil {
+			kvs = append(kvs, FieldError, err)
+		} else {
+			kvs = append(kvs, FieldBody, string(data))
+		}
+		c.eventLog().debug("sending request", kvs...)
+	}
+	return data, err
+}
+
+// eventLog returns the eventLog for c.EventLog, or c.Log if it is nil.
+func (c *Client) eventLog() eventLog {
+	if c.EventLog != nil {
+		return eventLog{c.EventLog}
+	}
+	c.initLog()
+	return newEventLog(c.Log)
+}
+
+// initLog sets c.Log to log.New(os.Stderr, "", 0) if it is nil and will be
+// used because c.DebugRequest is true and c.EventLog is nil.
+func (c *Client) initLog() {
+	if c.DebugRequest && c.EventLog == nil && c.Log == nil {
+		c.Log = log.New(os.Stderr, "", 0)
+	}
+}
+
+// request makes a single attempt to post reqData for method to url and parse
+// the Response with the given id using result, subject to c.Breaker.
+func (c *Client) request(ctx context.Context, url, method string, id ID,
+	reqData []byte, result interface{}) error {
+
+	trial, err := c.Breaker.allow(url, method)
+	if err != nil {
+		return err
 	}
-	reqData, err := req.MarshalJSON()
+	err = c.parse(ctx, url, id, reqData, result)
+	c.Breaker.record(ctx, url, method, trial, err)
+	return err
+}
+
+// parse posts reqData to url and parses the Response with the given id using
+// result.
+func (c *Client) parse(ctx context.Context, url string, id ID,
+	reqData []byte, result interface{}) error {
+
+	httpRes, body, err := c.post(ctx, url, reqData)
 	if err != nil {
 		return err
 	}
 
+	// Unmarshal the HTTP response into a JSON RPC response.
+	var resID ID
+	res := Response{Result: result, ID: &resID}
+	err = json.Unmarshal(body, &responseUnmarshaler{&res, c.decodeOptions()})
+	if err != nil {
+		return newErrorUnexpectedHTTPResponse(err, body, httpRes)
+	}
+	if resID != id && !(resID.IsNull() && res.HasError()) {
+		err := fmt.Errorf(`"id" %v does not match Request "id" %v`,
+			resID, id)
+		return newErrorUnexpectedHTTPResponse(err, body, httpRes)
+	}
+
+	if res.HasError() {
+		if c.Errors == nil {
+			return res.Error
+		}
+		// Decode the raw "data" separately, since res.Error.Data has
+		// already been decoded into an interface{}.
+		var e struct {
+			Error struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &e); err != nil {
+			return newErrorUnexpectedHTTPResponse(err, body, httpRes)
+		}
+		return c.Errors.typed(res.Error, e.Error.Data)
+	}
+
+	return nil
+}
+
+// decodeOptions returns the decodeOptions for Responses received by c.
+func (c *Client) decodeOptions() decodeOptions {
+	return decodeOptions{policy: c.DecodePolicy, version1: c.Version1}
+}
+
+// post reqData to url and return the http.Response along with its fully read
+// Body.
+func (c *Client) post(ctx context.Context, url string,
+	reqData []byte) (*http.Response, []byte, error) {
+
+	codec := c.Codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	reqData, err := codec.FromJSON(reqData)
+	if err != nil {
+		return nil, nil, err
+	}
+	var contentEncoding string
+	if c.Compression != nil && len(reqData) >= c.Compression.MinBytes {
+		contentEncoding = encodingGzip
+		reqData, err = c.Compression.compress(contentEncoding, reqData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Compose the HTTP request.
 	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqData))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if ctx != nil {
 		httpReq = httpReq.WithContext(ctx)
 	}
-	httpReq.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	httpReq.Header.Add(http.CanonicalHeaderKey("Content-Type"), codec.ContentType())
+	if codec != JSONCodec {
+		httpReq.Header.Add(http.CanonicalHeaderKey("Accept"),
+			codec.ContentType()+", "+JSONCodec.ContentType())
+	}
+	if contentEncoding != "" {
+		httpReq.Header.Add(http.CanonicalHeaderKey("Content-Encoding"),
+			contentEncoding)
+	}
+	// Setting Accept-Encoding disables the transparent gzip decompression
+	// of http.Transport, so the body is decompressed below instead.
+	httpReq.Header.Add(http.CanonicalHeaderKey("Accept-Encoding"),
+		encodingGzip+", "+encodingDeflate)
+	injectTrace(ctx, httpReq.Header)
 	for k, v := range c.Header {
 		httpReq.Header[http.CanonicalHeaderKey(k)] = v
 	}
@@ -140,30 +433,36 @@ func (c *Client) Request(ctx context.Context, url, method string,
 	// Make the request.
 	httpRes, err := c.Do(httpReq)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	defer httpRes.Body.Close()
 
-	// Read the HTTP response.
-	body, err := ioutil.ReadAll(httpRes.Body)
+	// Read the HTTP response, decompressing it if needed.
+	r, err := decompressor(httpRes.Body,
+		httpRes.Header.Get("Content-Encoding"))
 	if err != nil {
-		return err
+		return nil, nil, newErrorUnexpectedHTTPResponse(err, nil, httpRes)
 	}
-	if c.DebugRequest {
-		fmt.Println("<--", string(body))
-		fmt.Println()
+	body, err := ioutil.ReadAll(r)
+	var errDecompress decompressError
+	if errors.As(err, &errDecompress) {
+		return nil, nil, newErrorUnexpectedHTTPResponse(err, body, httpRes)
 	}
-
-	// Unmarshal the HTTP response into a JSON RPC response.
-	var resID int
-	res := Response{Result: result, ID: &resID}
-	if err := json.Unmarshal(body, &res); err != nil {
-		return newErrorUnexpectedHTTPResponse(err, body, httpRes)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	if res.HasError() {
-		return res.Error
+	if codecFor(httpRes.Header.Get("Content-Type"), []Codec{codec}) != nil {
+		jsonBody, err := codec.ToJSON(body)
+		if err != nil {
+			return nil, nil,
+				newErrorUnexpectedHTTPResponse(err, body, httpRes)
+		}
+		body = jsonBody
+	}
+	if c.DebugRequest {
+		c.eventLog().debug("received response",
+			FieldURL, url, FieldBody, string(body))
 	}
 
-	return nil
+	return httpRes, body, nil
 }
@@ -0,0 +1,65 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Command jsonrpc2-conformance checks that the JSON-RPC 2.0 server at a URL
+// conforms to the specification and prints a pass/fail report.
+//
+// Usage:
+//
+//	jsonrpc2-conformance [-spec] [-timeout duration] URL
+//
+// The exit status is 1 if any required check fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AdamSLevy/jsonrpc2/v14/conformance"
+)
+
+func main() {
+	spec := flag.Bool("spec", false,
+		"run the specification examples, which require its example methods")
+	timeout := flag.Duration("timeout", 10*time.Second,
+		"HTTP request timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %v [flags] URL\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	r := conformance.Run(flag.Arg(0), conformance.Options{
+		SpecMethods: *spec,
+		Client:      &http.Client{Timeout: *timeout},
+	})
+	fmt.Println(r)
+	if !r.Passed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Codec converts JSON-RPC 2.0 messages between JSON and another encoding, such
+// as MessagePack or CBOR, for use over HTTP.
+//
+// Requests, Responses and Errors are always validated and processed as JSON,
+// so they keep the same semantics regardless of the Codec. A Codec only needs
+// to represent the JSON data model: null, booleans, numbers, strings, arrays
+// and objects with string keys.
+//
+// Use WithCodecs to enable Codecs for the HTTPRequestHandler, or set
+// Client.Codec.
+type Codec interface {
+	// ContentType returns the media type of the encoding, such as
+	// "application/msgpack", which is used in the Content-Type and Accept
+	// headers.
+	ContentType() string
+
+	// FromJSON converts the valid JSON in data to the encoding.
+	FromJSON(data []byte) ([]byte, error)
+
+	// ToJSON converts data in the encoding to JSON.
+	ToJSON(data []byte) ([]byte, error)
+}
+
+// JSONCodec is the default Codec, which leaves JSON unchanged.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+// ContentType returns "application/json".
+func (jsonCodec) ContentType() string { return "application/json" }
+
+// FromJSON returns data.
+func (jsonCodec) FromJSON(data []byte) ([]byte, error) { return data, nil }
+
+// ToJSON returns data.
+func (jsonCodec) ToJSON(data []byte) ([]byte, error) { return data, nil }
+
+// WithCodecs returns a HandlerOption that allows the HTTPRequestHandler to
+// use codecs, in addition to JSON, for the http.Request and http.Response
+// bodies.
+//
+// The Codec for the http.Request body is selected by its Content-Type
+// header, and JSON is used if no Codec matches.
+//
+// The Codec for the http.Response body is the first in the Accept header
+// that matches a Codec or "application/json", ignoring any with q=0. The
+// Codec of the http.Request body is used if there is no Accept header, or if
+// it includes a wildcard before any match. Otherwise JSON is used.
+//
+// Any Limits.MaxBodyBytes applies to the encoded http.Request body.
+func WithCodecs(codecs ...Codec) HandlerOption {
+	return func(h *handler) {
+		h.codecs = append(h.codecs, codecs...)
+	}
+}
+
+// negotiate returns the Codecs in codecs for the body of req and the body of
+// its http.Response, based on the Content-Type and Accept headers. See
+// WithCodecs.
+func negotiate(req *http.Request, codecs []Codec) (reqCodec, resCodec Codec) {
+	reqCodec = codecFor(req.Header.Get("Content-Type"), codecs)
+	if reqCodec == nil {
+		reqCodec = JSONCodec
+	}
+
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return reqCodec, reqCodec
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil &&
+			q <= 0 {
+			continue
+		}
+		switch mediaType {
+		case "*/*", "application/*":
+			return reqCodec, reqCodec
+		case JSONCodec.ContentType():
+			return reqCodec, JSONCodec
+		}
+		if codec := codecFor(mediaType, codecs); codec != nil {
+			return reqCodec, codec
+		}
+	}
+	return reqCodec, JSONCodec
+}
+
+// codecFor returns the Codec in codecs with the media type in contentType, or
+// nil if there is none.
+func codecFor(contentType string, codecs []Codec) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, codec := range codecs {
+		if codec != nil && codec.ContentType() == mediaType {
+			return codec
+		}
+	}
+	return nil
+}
+
+// maxCodecDepth limits the nesting depth of arrays and objects, so that
+// converting deeply nested data cannot exhaust the stack.
+const maxCodecDepth = 10000
+
+// errCodecDepth is returned if maxCodecDepth is exceeded.
+var errCodecDepth = fmt.Errorf("nesting depth exceeds %v", maxCodecDepth)
+
+// binaryWriter writes JSON values in a binary encoding.
+type binaryWriter interface {
+	writeNull(b *bytes.Buffer)
+	writeBool(b *bytes.Buffer, v bool)
+	writeInt(b *bytes.Buffer, v int64)
+	writeUint(b *bytes.Buffer, v uint64)
+	writeFloat(b *bytes.Buffer, v float64)
+	writeString(b *bytes.Buffer, v string)
+	writeArray(b *bytes.Buffer, n int)
+	writeMap(b *bytes.Buffer, n int)
+}
+
+// fromJSON converts the JSON in data to the encoding of w.
+//
+// Numbers are written as integers if they are integers in the range of
+// int64 or uint64, written without a fraction or exponent, and otherwise as
+// floats.
+func fromJSON(w binaryWriter, data []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var b bytes.Buffer
+	if err := writeValue(w, d, &b, 0); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON after top level value")
+	}
+	return b.Bytes(), nil
+}
+
+// writeValue reads the next JSON value from d and writes it to b using w.
+func writeValue(w binaryWriter, d *json.Decoder, b *bytes.Buffer,
+	depth int) error {
+
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if depth++; depth > maxCodecDepth {
+			return errCodecDepth
+		}
+		// The number of elements must be written before the elements
+		// themselves.
+		var elems bytes.Buffer
+		var n int
+		for ; d.More(); n++ {
+			if v == '{' {
+				key, err := d.Token()
+				if err != nil {
+					return err
+				}
+				w.writeString(&elems, key.(string))
+			}
+			if err := writeValue(w, d, &elems, depth); err != nil {
+				return err
+			}
+		}
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+		if v == '{' {
+			w.writeMap(b, n)
+		} else {
+			w.writeArray(b, n)
+		}
+		b.Write(elems.Bytes())
+	case nil:
+		w.writeNull(b)
+	case bool:
+		w.writeBool(b, v)
+	case string:
+		w.writeString(b, v)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			w.writeInt(b, i)
+		} else if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			w.writeUint(b, u)
+		} else {
+			// Only a range error is possible for a valid Number,
+			// which is ignored unless it overflows.
+			f, _ := strconv.ParseFloat(string(v), 64)
+			if math.IsInf(f, 0) {
+				return fmt.Errorf("number out of range: %v", v)
+			}
+			w.writeFloat(b, f)
+		}
+	}
+	return nil
+}
+
+// binaryReader reads bytes from binary encoded data.
+type binaryReader struct {
+	data  []byte
+	depth int
+}
+
+// errUnexpectedEnd is returned when encoded data ends before a complete value.
+var errUnexpectedEnd = fmt.Errorf("unexpected end of data")
+
+// next returns the next n bytes.
+func (r *binaryReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)) {
+		return nil, errUnexpectedEnd
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// uint returns the next n bytes as a big endian unsigned integer.
+func (r *binaryReader) uint(n int) (uint64, error) {
+	b, err := r.next(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// enter increments the nesting depth, returning an error if it exceeds
+// maxCodecDepth. It must be followed by a call to r.exit.
+func (r *binaryReader) enter() error {
+	if r.depth++; r.depth > maxCodecDepth {
+		return errCodecDepth
+	}
+	return nil
+}
+
+// exit decrements the nesting depth.
+func (r *binaryReader) exit() {
+	r.depth--
+}
+
+// writeJSONString writes s to b as a JSON String.
+func writeJSONString(b *bytes.Buffer, s string) {
+	data, _ := marshalJSON(s) // A string cannot cause an error.
+	b.Write(data)
+}
+
+// writeJSONBytes writes data to b as a base64 encoded JSON String, since JSON
+// has no type for binary data.
+func writeJSONBytes(b *bytes.Buffer, data []byte) {
+	b.WriteByte('"')
+	b.WriteString(base64.StdEncoding.EncodeToString(data))
+	b.WriteByte('"')
+}
+
+// writeJSONFloat writes f to b as a JSON Number.
+func writeJSONFloat(b *bytes.Buffer, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("unsupported float: %v", f)
+	}
+	b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	return nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var codecRoundTripTests = []string{
+	`null`, `true`, `false`,
+	`0`, `127`, `128`, `255`, `256`, `65535`, `65536`, `4294967295`,
+	`4294967296`, `9223372036854775807`, `18446744073709551615`,
+	`-1`, `-32`, `-33`, `-128`, `-129`, `-32768`, `-32769`, `-2147483648`,
+	`-2147483649`, `-9223372036854775808`,
+	`1.5`, `-0.25`, `0.1`, `1e+300`,
+	`""`, `"a<b>&c"`, `"héllo, 世界"`, `"` + strings.Repeat("a", 31) + `"`,
+	`"` + strings.Repeat("a", 32) + `"`, `"` + strings.Repeat("a", 256) + `"`,
+	`"` + strings.Repeat("a", 65536) + `"`,
+	`[]`, `[1,[2,[3]],{}]`, `[` + strings.Repeat("0,", 15) + `0]`,
+	`{"jsonrpc":"2.0","method":"a","params":{"b":[1,null]},"id":"x"}`,
+	`{"` + strings.Repeat(`a":0,"`, 16) + `b":1}`,
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{MessagePackCodec, CBORCodec} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			for _, test := range codecRoundTripTests {
+				data, err := codec.FromJSON([]byte(test))
+				if !assert.NoError(t, err, test) {
+					continue
+				}
+				out, err := codec.ToJSON(data)
+				if assert.NoError(t, err, test) {
+					assert.Equal(t, test, string(out))
+				}
+			}
+		})
+	}
+}
+
+var codecToJSONTests = []struct {
+	Codec Codec
+	Hex   string
+	JSON  string
+	Err   string
+}{
+	{Codec: MessagePackCodec, Hex: "81a16101", JSON: `{"a":1}`},
+	{Codec: MessagePackCodec, Hex: "c403010203", JSON: `"AQID"`},
+	{Codec: MessagePackCodec, Hex: "d1ff00", JSON: `-256`},
+	{Codec: MessagePackCodec, Hex: "ca3fc00000", JSON: `1.5`},
+	{Codec: MessagePackCodec, Hex: "d90161", JSON: `"a"`},
+	{Codec: MessagePackCodec, Hex: "dc0001c0", JSON: `[null]`},
+	{Codec: MessagePackCodec, Hex: "810101",
+		Err: "msgpack: unsupported map key type 0x01"},
+	{Codec: MessagePackCodec, Hex: "c7",
+		Err: "msgpack: unsupported type 0xc7"},
+	{Codec: MessagePackCodec, Hex: "92c0",
+		Err: "msgpack: unexpected end of data"},
+	{Codec: MessagePackCodec, Hex: "c0c0",
+		Err: "msgpack: 1 bytes after top level value"},
+	{Codec: MessagePackCodec, Hex: "dbffffffff",
+		Err: "msgpack: unexpected end of data"},
+	{Codec: MessagePackCodec, Hex: "cb7ff0000000000000",
+		Err: "msgpack: unsupported float: +Inf"},
+
+	{Codec: CBORCodec, Hex: "a1616101", JSON: `{"a":1}`},
+	{Codec: CBORCodec, Hex: "8201820203", JSON: `[1,[2,3]]`},
+	{Codec: CBORCodec, Hex: "f93c00", JSON: `1`},
+	{Codec: CBORCodec, Hex: "f90000", JSON: `0`},
+	{Codec: CBORCodec, Hex: "f90001", JSON: `5.960464477539063e-08`},
+	{Codec: CBORCodec, Hex: "f9c400", JSON: `-4`},
+	{Codec: CBORCodec, Hex: "fa3fc00000", JSON: `1.5`},
+	{Codec: CBORCodec, Hex: "9f0102ff", JSON: `[1,2]`},
+	{Codec: CBORCodec, Hex: "bf616101ff", JSON: `{"a":1}`},
+	{Codec: CBORCodec, Hex: "7f61616162ff", JSON: `"ab"`},
+	{Codec: CBORCodec, Hex: "5f42010241ffff", JSON: `"AQL/"`},
+	{Codec: CBORCodec, Hex: "c11a514b67b0", JSON: `1363896240`},
+	{Codec: CBORCodec, Hex: "3bffffffffffffffff",
+		JSON: `-18446744073709551616`},
+	{Codec: CBORCodec, Hex: "f7", JSON: `null`},
+	{Codec: CBORCodec, Hex: "a10101",
+		Err: "cbor: unsupported map key major type 0"},
+	{Codec: CBORCodec, Hex: "f0", Err: "cbor: unsupported simple value 16"},
+	{Codec: CBORCodec, Hex: "1c",
+		Err: "cbor: invalid additional information 28 for major type 0"},
+	{Codec: CBORCodec, Hex: "7f6161",
+		Err: "cbor: unexpected end of data"},
+	{Codec: CBORCodec, Hex: "7f4161ff",
+		Err: "cbor: invalid indefinite length string chunk"},
+	{Codec: CBORCodec, Hex: "9bffffffffffffffff",
+		Err: "cbor: unexpected end of data"},
+}
+
+func TestCodecToJSON(t *testing.T) {
+	for _, test := range codecToJSONTests {
+		data, err := hex.DecodeString(test.Hex)
+		if !assert.NoError(t, err, test.Hex) {
+			continue
+		}
+		out, err := test.Codec.ToJSON(data)
+		if test.Err != "" {
+			assert.EqualError(t, err, test.Err, test.Hex)
+			continue
+		}
+		if assert.NoError(t, err, test.Hex) {
+			assert.Equal(t, test.JSON, string(out), test.Hex)
+		}
+	}
+}
+
+func TestCodecDepth(t *testing.T) {
+	assert := assert.New(t)
+	data := bytes.Repeat([]byte{0x91}, maxCodecDepth+1)
+	_, err := MessagePackCodec.ToJSON(append(data, 0xc0))
+	assert.EqualError(err, "msgpack: "+errCodecDepth.Error())
+
+	data = bytes.Repeat([]byte{0xa1, 0x61, 0x61}, maxCodecDepth+1)
+	_, err = CBORCodec.ToJSON(append(data, 0xf6))
+	assert.EqualError(err, "cbor: "+errCodecDepth.Error())
+
+	deep := strings.Repeat("[", maxCodecDepth+1) +
+		strings.Repeat("]", maxCodecDepth+1)
+	_, err = CBORCodec.FromJSON([]byte(deep))
+	assert.Error(err)
+}
+
+var negotiateTests = []struct {
+	ContentType string
+	Accept      string
+	Res         Codec
+}{
+	{Res: JSONCodec},
+	{ContentType: "application/msgpack", Res: MessagePackCodec},
+	{ContentType: "application/cbor; charset=binary", Res: CBORCodec},
+	{ContentType: "application/xml", Res: JSONCodec},
+	{Accept: "application/cbor", Res: CBORCodec},
+	{ContentType: "application/msgpack", Accept: "application/json",
+		Res: JSONCodec},
+	{ContentType: "application/msgpack", Accept: "*/*",
+		Res: MessagePackCodec},
+	{Accept: "text/html, application/cbor;q=0, application/msgpack",
+		Res: MessagePackCodec},
+	{ContentType: "application/cbor", Accept: "text/html",
+		Res: JSONCodec},
+}
+
+func TestWithCodecs(t *testing.T) {
+	h := HTTPRequestHandler(MethodMap{
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		}}, nil, WithCodecs(MessagePackCodec, CBORCodec))
+
+	reqJSON := `{"jsonrpc":"2.0","method":"echo","params":[1.5,"a"],"id":1}`
+	resJSON := `{"jsonrpc":"2.0","result":[1.5,"a"],"id":1}` + "\n"
+	for _, test := range negotiateTests {
+		assert := assert.New(t)
+		msg := test.ContentType + " " + test.Accept
+
+		reqCodec := codecFor(test.ContentType,
+			[]Codec{MessagePackCodec, CBORCodec})
+		if reqCodec == nil {
+			reqCodec = JSONCodec
+		}
+		body, err := reqCodec.FromJSON([]byte(reqJSON))
+		assert.NoError(err, msg)
+
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBuffer(body))
+		if test.ContentType != "" {
+			req.Header.Set("Content-Type", test.ContentType)
+		}
+		if test.Accept != "" {
+			req.Header.Set("Accept", test.Accept)
+		}
+		w := httptest.NewRecorder()
+		h(w, req)
+
+		assert.Equal(test.Res.ContentType(),
+			w.Header().Get("Content-Type"), msg)
+		assert.Equal("Accept", w.Header().Get("Vary"), msg)
+		res, err := test.Res.ToJSON(w.Body.Bytes())
+		assert.NoError(err, msg)
+		assert.Equal(strings.TrimSpace(resJSON),
+			strings.TrimSpace(string(res)), msg)
+	}
+
+	// An invalid encoding is a Parse error.
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString("\xc7"))
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h(w, req)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32700,`+
+		`"message":"Parse error","data":"msgpack: unsupported type 0xc7"},`+
+		`"id":null}`+"\n", w.Body.String())
+}
+
+func TestClientCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	var contentType, accept string
+	var invalid bool
+	h := HTTPRequestHandler(MethodMap{
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		}}, nil, WithCodecs(CBORCodec))
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			accept = r.Header.Get("Accept")
+			if invalid {
+				w.Header().Set("Content-Type", "application/cbor")
+				w.Write([]byte{0xff})
+				return
+			}
+			h(w, r)
+		}))
+	defer srv.Close()
+
+	c := Client{Codec: CBORCodec}
+	var result []interface{}
+	assert.NoError(c.Request(nil, srv.URL, "echo", []interface{}{1, "a"},
+		&result))
+	assert.Equal([]interface{}{1.0, "a"}, result)
+	assert.Equal("application/cbor", contentType)
+	assert.Equal("application/cbor, application/json", accept)
+
+	// A JSON Response is always accepted.
+	c.Header = http.Header{"Accept": []string{"application/json"}}
+	result = nil
+	assert.NoError(c.Request(nil, srv.URL, "echo", []interface{}{2},
+		&result))
+	assert.Equal([]interface{}{2.0}, result)
+
+	// An invalid encoding is an ErrorUnexpectedHTTPResponse.
+	invalid = true
+	err := c.Request(nil, srv.URL, "echo", nil, &result)
+	assert.IsType(ErrorUnexpectedHTTPResponse{}, err)
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Compression configures gzip and deflate compression of HTTP bodies.
+//
+// Use WithCompression to enable compression for the HTTPRequestHandler, or
+// set Client.Compression.
+type Compression struct {
+	// MinBytes is the size in bytes below which bodies are not
+	// compressed, since the overhead may outweigh the benefit.
+	MinBytes int
+
+	// Level is the compression level, as defined by the compress/flate
+	// package. Zero uses flate.DefaultCompression.
+	Level int
+}
+
+// WithCompression returns a HandlerOption that enables compression for the
+// HTTPRequestHandler.
+//
+// An http.Response body of at least c.MinBytes is compressed using gzip or
+// deflate, whichever is preferred by the Accept-Encoding header of the
+// http.Request. Otherwise the body is not compressed.
+//
+// An http.Request body with a Content-Encoding of gzip or deflate is
+// decompressed, and any Limits.MaxBodyBytes applies to the decompressed size.
+// An http.Request with any other Content-Encoding receives a Parse error
+// with the status code 415 Unsupported Media Type.
+func WithCompression(c Compression) HandlerOption {
+	return func(h *handler) {
+		h.compression = &c
+	}
+}
+
+// Supported values of the Content-Encoding and Accept-Encoding headers. Note
+// that "deflate" is the zlib format.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// compress returns data compressed using encoding.
+func (c Compression) compress(encoding string, data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch encoding {
+	case encodingGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case encodingDeflate:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	default:
+		err = fmt.Errorf("%w: %v", errUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality
+// value in the Accept-Encoding header, preferring gzip, or "" if neither is
+// acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	// A quality value of -1 indicates the encoding was not listed.
+	qGzip, qDeflate, qAny := -1.0, -1.0, -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, err := mime.ParseMediaType(coding)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch name {
+		case encodingGzip, "x-gzip":
+			qGzip = q
+		case encodingDeflate:
+			qDeflate = q
+		case "*":
+			qAny = q
+		}
+	}
+	if qGzip < 0 {
+		qGzip = qAny
+	}
+	if qDeflate < 0 {
+		qDeflate = qAny
+	}
+	switch {
+	case qGzip > 0 && qGzip >= qDeflate:
+		return encodingGzip
+	case qDeflate > 0:
+		return encodingDeflate
+	}
+	return ""
+}
+
+// errUnsupportedEncoding is returned for an unsupported Content-Encoding.
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// decompressor returns an io.Reader that decompresses r according to the
+// contentEncoding header. Errors from reading the returned io.Reader are
+// wrapped in a decompressError.
+func decompressor(r io.Reader, contentEncoding string) (io.Reader, error) {
+	var err error
+	encoding := strings.ToLower(strings.TrimSpace(contentEncoding))
+	switch encoding {
+	case "", "identity":
+		return r, nil
+	case encodingGzip, "x-gzip":
+		r, err = gzip.NewReader(r)
+	case encodingDeflate:
+		r, err = zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("%w: %v", errUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return nil, decompressError{err}
+	}
+	return decompressReader{r}, nil
+}
+
+// decompressError wraps an error that occurred while decompressing.
+type decompressError struct {
+	error
+}
+
+// Unwrap returns the wrapped error.
+func (err decompressError) Unwrap() error {
+	return err.error
+}
+
+// decompressReader wraps errors from the underlying io.Reader in a
+// decompressError.
+type decompressReader struct {
+	io.Reader
+}
+
+// Read implements io.Reader.
+func (r decompressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = decompressError{err}
+	}
+	return n, err
+}
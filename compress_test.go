@@ -0,0 +1,242 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var negotiateEncodingTests = []struct {
+	AcceptEncoding string
+	Encoding       string
+}{
+	{"", ""},
+	{"identity", ""},
+	{"gzip", "gzip"},
+	{"deflate", "deflate"},
+	{"deflate, gzip", "gzip"},
+	{"deflate, gzip;q=0.5", "deflate"},
+	{"gzip;q=0, deflate", "deflate"},
+	{"*", "gzip"},
+	{"gzip;q=0, *", "deflate"},
+	{"*;q=0", ""},
+	{"br, x-gzip", "gzip"},
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, test := range negotiateEncodingTests {
+		assert.Equal(t, test.Encoding,
+			negotiateEncoding(test.AcceptEncoding), test.AcceptEncoding)
+	}
+}
+
+// compressTestMethods can repeat a string to produce a Response of any size.
+var compressTestMethods = MethodMap{
+	"repeat": func(_ context.Context, params json.RawMessage) interface{} {
+		var p struct {
+			S string
+			N int
+		}
+		json.Unmarshal(params, &p)
+		return strings.Repeat(p.S, p.N)
+	},
+}
+
+func TestWithCompression(t *testing.T) {
+	h := HTTPRequestHandler(compressTestMethods, nil,
+		WithCompression(Compression{MinBytes: 100}),
+		WithLimits(Limits{MaxBodyBytes: 1000}))
+
+	serve := func(body []byte, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBuffer(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+	request := func(n int) []byte {
+		return []byte(`{"jsonrpc":"2.0","method":"repeat",` +
+			`"params":{"S":"a","N":` + strconv.Itoa(n) + `},"id":1}`)
+	}
+	result := func(n int) string {
+		return `{"jsonrpc":"2.0","result":"` + strings.Repeat("a", n) +
+			`","id":1}` + "\n"
+	}
+
+	t.Run("gzip response", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(request(200), http.Header{
+			"Accept-Encoding": []string{"gzip"}})
+		assert.Equal("gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal("Accept-Encoding", w.Header().Get("Vary"))
+		r, err := gzip.NewReader(w.Body)
+		if assert.NoError(err) {
+			data, err := ioutil.ReadAll(r)
+			assert.NoError(err)
+			assert.Equal(result(200), string(data))
+		}
+	})
+	t.Run("deflate response", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(request(200), http.Header{
+			"Accept-Encoding": []string{"deflate"}})
+		assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+		r, err := zlib.NewReader(w.Body)
+		if assert.NoError(err) {
+			data, err := ioutil.ReadAll(r)
+			assert.NoError(err)
+			assert.Equal(result(200), string(data))
+		}
+	})
+	t.Run("below threshold", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(request(10), http.Header{
+			"Accept-Encoding": []string{"gzip"}})
+		assert.Empty(w.Header().Get("Content-Encoding"))
+		assert.Equal(result(10), w.Body.String())
+	})
+	t.Run("not accepted", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(request(200), nil)
+		assert.Empty(w.Header().Get("Content-Encoding"))
+		assert.Equal(result(200), w.Body.String())
+	})
+	t.Run("gzip request", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(gzipBytes(request(10)), http.Header{
+			"Content-Encoding": []string{"gzip"}})
+		assert.Equal(result(10), w.Body.String())
+	})
+	t.Run("deflate request", func(t *testing.T) {
+		assert := assert.New(t)
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(request(10))
+		zw.Close()
+		w := serve(buf.Bytes(), http.Header{
+			"Content-Encoding": []string{"deflate"}})
+		assert.Equal(result(10), w.Body.String())
+	})
+	t.Run("decompressed limit", func(t *testing.T) {
+		assert := assert.New(t)
+		body := append(request(10), bytes.Repeat([]byte(" "), 1000)...)
+		compressed := gzipBytes(body)
+		assert.True(len(compressed) < 1000)
+		w := serve(compressed, http.Header{
+			"Content-Encoding": []string{"gzip"}})
+		assert.Equal(http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(w.Body.String(),
+			"request body exceeds limit of 1000 bytes")
+	})
+	t.Run("unsupported encoding", func(t *testing.T) {
+		assert := assert.New(t)
+		w := serve(request(10), http.Header{
+			"Content-Encoding": []string{"br"}})
+		assert.Equal(http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":-32700,`+
+			`"message":"Parse error",`+
+			`"data":"unsupported Content-Encoding: br"},"id":null}`+"\n",
+			w.Body.String())
+	})
+	t.Run("corrupt request", func(t *testing.T) {
+		assert := assert.New(t)
+		body := gzipBytes(request(10))
+		body[len(body)-5]++ // Corrupt the checksum.
+		w := serve(body, http.Header{
+			"Content-Encoding": []string{"gzip"}})
+		assert.Contains(w.Body.String(), `"code":-32700`)
+		assert.Contains(w.Body.String(), "checksum")
+
+		w = serve(request(10), http.Header{
+			"Content-Encoding": []string{"gzip"}})
+		assert.Contains(w.Body.String(), `"code":-32700`)
+	})
+}
+
+func TestClientCompression(t *testing.T) {
+	assert := assert.New(t)
+
+	var contentEncoding string
+	var corrupt bool
+	h := HTTPRequestHandler(compressTestMethods, nil,
+		WithCompression(Compression{MinBytes: 100}))
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			contentEncoding = r.Header.Get("Content-Encoding")
+			if corrupt {
+				w.Header().Set("Content-Encoding", "deflate")
+				w.Write([]byte("not deflate"))
+				return
+			}
+			h(w, r)
+		}))
+	defer srv.Close()
+
+	c := Client{Compression: &Compression{MinBytes: 50}}
+	var result string
+	params := struct {
+		S string
+		N int
+	}{"abc", 100}
+	assert.NoError(c.Request(nil, srv.URL, "repeat", params, &result))
+	assert.Equal(strings.Repeat("abc", 100), result)
+	assert.Equal("gzip", contentEncoding)
+
+	// Small requests are not compressed.
+	params.S = strings.Repeat("x", 2)
+	c.Compression.MinBytes = 1000
+	assert.NoError(c.Request(nil, srv.URL, "repeat", params, &result))
+	assert.Equal(strings.Repeat("x", 200), result)
+	assert.Empty(contentEncoding)
+
+	// Deflate Responses are also decompressed.
+	c.Header = http.Header{"Accept-Encoding": []string{"deflate"}}
+	assert.NoError(c.Request(nil, srv.URL, "repeat", params, &result))
+	assert.Equal(strings.Repeat("x", 200), result)
+
+	corrupt = true
+	err := c.Request(nil, srv.URL, "repeat", params, &result)
+	assert.IsType(ErrorUnexpectedHTTPResponse{}, err)
+}
+
+// gzipBytes returns data compressed using gzip.
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package conformance
+
+// missing is a method name that the server is assumed not to implement.
+const missing = "conformance.missing"
+
+// specChecks are the examples from the specification.
+var specChecks = []check{{
+	Name:   "spec: rpc call with positional parameters",
+	Body:   `{"jsonrpc":"2.0","method":"subtract","params":[42,23],"id":1}`,
+	Expect: `{"jsonrpc":"2.0","result":19,"id":1}`,
+}, {
+	Name:   "spec: rpc call with positional parameters, reversed",
+	Body:   `{"jsonrpc":"2.0","method":"subtract","params":[23,42],"id":2}`,
+	Expect: `{"jsonrpc":"2.0","result":-19,"id":2}`,
+}, {
+	Name:   "spec: rpc call with named parameters",
+	Body:   `{"jsonrpc":"2.0","method":"subtract","params":{"subtrahend":23,"minuend":42},"id":3}`,
+	Expect: `{"jsonrpc":"2.0","result":19,"id":3}`,
+}, {
+	Name:   "spec: rpc call with named parameters, reordered",
+	Body:   `{"jsonrpc":"2.0","method":"subtract","params":{"minuend":42,"subtrahend":23},"id":4}`,
+	Expect: `{"jsonrpc":"2.0","result":19,"id":4}`,
+}, {
+	Name: "spec: a Notification",
+	Body: `{"jsonrpc":"2.0","method":"update","params":[1,2,3,4,5]}`,
+}, {
+	Name: "spec: a Notification without params",
+	Body: `{"jsonrpc":"2.0","method":"foobar"}`,
+}, {
+	Name:   "spec: rpc call of non-existent method",
+	Body:   `{"jsonrpc":"2.0","method":"foobar","id":"1"}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32601},"id":"1"}`,
+}, {
+	Name:   "spec: rpc call with invalid JSON",
+	Body:   `{"jsonrpc":"2.0","method":"foobar,"params":"bar","baz]`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32700},"id":null}`,
+}, {
+	Name:   "spec: rpc call with invalid Request object",
+	Body:   `{"jsonrpc":"2.0","method":1,"params":"bar"}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name: "spec: rpc call Batch, invalid JSON",
+	Body: `[
+  {"jsonrpc":"2.0","method":"sum","params":[1,2,4],"id":"1"},
+  {"jsonrpc":"2.0","method"
+]`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32700},"id":null}`,
+}, {
+	Name:   "spec: rpc call with an empty Array",
+	Body:   `[]`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "spec: rpc call with an invalid Batch (but not empty)",
+	Body:   `[1]`,
+	Expect: `[{"jsonrpc":"2.0","error":{"code":-32600},"id":null}]`,
+}, {
+	Name: "spec: rpc call with invalid Batch",
+	Body: `[1,2,3]`,
+	Expect: `[
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null},
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null},
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null}
+]`,
+}, {
+	Name: "spec: rpc call Batch",
+	Body: `[
+  {"jsonrpc":"2.0","method":"sum","params":[1,2,4],"id":"1"},
+  {"jsonrpc":"2.0","method":"notify_hello","params":[7]},
+  {"jsonrpc":"2.0","method":"subtract","params":[42,23],"id":"2"},
+  {"foo":"boo"},
+  {"jsonrpc":"2.0","method":"foo.get","params":{"name":"myself"},"id":"5"},
+  {"jsonrpc":"2.0","method":"get_data","id":"9"}
+]`,
+	Expect: `[
+  {"jsonrpc":"2.0","result":7,"id":"1"},
+  {"jsonrpc":"2.0","result":19,"id":"2"},
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null},
+  {"jsonrpc":"2.0","error":{"code":-32601},"id":"5"},
+  {"jsonrpc":"2.0","result":["hello",5],"id":"9"}
+]`,
+}, {
+	Name: "spec: rpc call Batch (all notifications)",
+	Body: `[
+  {"jsonrpc":"2.0","method":"notify_sum","params":[1,2,4]},
+  {"jsonrpc":"2.0","method":"notify_hello","params":[7]}
+]`,
+}}
+
+// protocolChecks do not depend on any methods implemented by the server.
+var protocolChecks = []check{{
+	Name:   "invalid JSON",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":1`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32700},"id":null}`,
+}, {
+	Name:   "method not found with string id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":"abc"}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32601},"id":"abc"}`,
+}, {
+	Name:   "method not found with number id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":-42}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32601},"id":-42}`,
+}, {
+	Name:   "method not found with null id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":null}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32601},"id":null}`,
+}, {
+	Name: "method not found Notification",
+	Body: `{"jsonrpc":"2.0","method":"` + missing + `","params":[1]}`,
+}, {
+	Name:   "reserved rpc. method name",
+	Body:   `{"jsonrpc":"2.0","method":"rpc.` + missing + `","id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32601},"id":1}`,
+}, {
+	Name:   "missing jsonrpc",
+	Body:   `{"method":"` + missing + `","id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "invalid jsonrpc version",
+	Body:   `{"jsonrpc":"1.0","method":"` + missing + `","id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "missing method",
+	Body:   `{"jsonrpc":"2.0","id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "null method",
+	Body:   `{"jsonrpc":"2.0","method":null,"id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "object id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":{}}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "array id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":[1]}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "boolean id",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","id":true}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:     "fractional id",
+	Optional: true,
+	Body:     `{"jsonrpc":"2.0","method":"` + missing + `","id":1.5}`,
+	Expect:   `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "string params",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","params":"bar","id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "number params",
+	Body:   `{"jsonrpc":"2.0","method":"` + missing + `","params":1,"id":1}`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:     "unknown field",
+	Optional: true,
+	Body:     `{"jsonrpc":"2.0","method":"` + missing + `","id":1,"foo":1}`,
+	Expect:   `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "non-object Request",
+	Body:   `"` + missing + `"`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name:   "empty batch",
+	Body:   `[]`,
+	Expect: `{"jsonrpc":"2.0","error":{"code":-32600},"id":null}`,
+}, {
+	Name: "batch of invalid Requests",
+	Body: `[1,"a",null]`,
+	Expect: `[
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null},
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null},
+  {"jsonrpc":"2.0","error":{"code":-32600},"id":null}
+]`,
+}, {
+	Name: "batch with Notifications and Requests",
+	Body: `[
+  {"jsonrpc":"2.0","method":"` + missing + `"},
+  {"jsonrpc":"2.0","method":"` + missing + `","id":"a"},
+  {"jsonrpc":"2.0","method":"` + missing + `","id":2}
+]`,
+	Expect: `[
+  {"jsonrpc":"2.0","error":{"code":-32601},"id":"a"},
+  {"jsonrpc":"2.0","error":{"code":-32601},"id":2}
+]`,
+}, {
+	Name: "batch of Notifications",
+	Body: `[
+  {"jsonrpc":"2.0","method":"` + missing + `"},
+  {"jsonrpc":"2.0","method":"` + missing + `","params":{}}
+]`,
+}, {
+	Name:   "nested batch",
+	Body:   `[[]]`,
+	Expect: `[{"jsonrpc":"2.0","error":{"code":-32600},"id":null}]`,
+}}
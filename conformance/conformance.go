@@ -0,0 +1,283 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package conformance checks that a JSON-RPC 2.0 server conforms to the
+// specification by sending it a suite of requests over HTTP.
+//
+// The suite covers the protocol errors and edge cases of the specification,
+// such as invalid JSON, invalid Request objects, empty and invalid batches,
+// invalid "id" types, Notifications and reserved "rpc." method names. These
+// checks do not depend on any methods implemented by the server.
+//
+// If Options.SpecMethods is true, the examples from the specification are
+// also run, which require the server to implement the "subtract", "sum",
+// "notify_hello" and "get_data" methods as described there.
+//
+// The full specification can be found at https://www.jsonrpc.org.
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+)
+
+// Options configures a run of the conformance suite.
+type Options struct {
+	// SpecMethods enables the examples from the specification, which
+	// require the methods that they call.
+	SpecMethods bool
+
+	// Client is used to send requests to a URL. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	// Name describes the check.
+	Name string
+
+	// Required is false for checks of behavior that the specification
+	// does not strictly require, such as rejecting unknown fields.
+	Required bool
+
+	// Pass is true if the server behaved as expected.
+	Pass bool
+
+	// Detail explains a failure.
+	Detail string
+}
+
+// Report holds the Results of a run of the conformance suite.
+type Report struct {
+	Results []Result
+}
+
+// Passed returns true if all Required checks passed.
+func (r Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Required && !res.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a line for each Result prefixed with PASS, FAIL, or WARN for
+// a failed check that is not Required, followed by a summary line.
+func (r Report) String() string {
+	var s strings.Builder
+	var pass, fail, warn int
+	for _, res := range r.Results {
+		status := "PASS"
+		switch {
+		case res.Pass:
+			pass++
+		case res.Required:
+			status = "FAIL"
+			fail++
+		default:
+			status = "WARN"
+			warn++
+		}
+		fmt.Fprintf(&s, "%v: %v\n", status, res.Name)
+		if !res.Pass {
+			fmt.Fprintf(&s, "      %v\n", res.Detail)
+		}
+	}
+	fmt.Fprintf(&s, "%v passed, %v failed, %v warnings", pass, fail, warn)
+	return s.String()
+}
+
+// Run runs the conformance suite against the JSON-RPC 2.0 server at url.
+func Run(url string, opts Options) Report {
+	c := opts.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return run(func(body string) ([]byte, error) {
+		res, err := c.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		return ioutil.ReadAll(res.Body)
+	}, opts)
+}
+
+// RunHandler runs the conformance suite against h without any network.
+func RunHandler(h http.Handler, opts Options) Report {
+	return run(func(body string) ([]byte, error) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/",
+			strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(w, req)
+		return w.Body.Bytes(), nil
+	}, opts)
+}
+
+// run sends the body of each check using post and compares the response.
+func run(post func(body string) ([]byte, error), opts Options) Report {
+	checks := protocolChecks
+	if opts.SpecMethods {
+		checks = append(specChecks, checks...)
+	}
+	var r Report
+	for _, c := range checks {
+		res := Result{Name: c.Name, Required: !c.Optional}
+		body, err := post(c.Body)
+		if err == nil {
+			err = c.compare(body)
+		}
+		res.Pass = err == nil
+		if err != nil {
+			res.Detail = err.Error()
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// check is a single request and its expected response.
+type check struct {
+	Name     string
+	Optional bool
+	Body     string
+
+	// Expect is the expected Response object, an array of expected
+	// Response objects for a batch, or empty if no response is expected.
+	//
+	// An expected Response object must have a "result" or an "error"
+	// with a "code", and an "id". Only these members are compared,
+	// since the "message" and "data" of an "error" are defined by the
+	// server.
+	Expect string
+}
+
+// compare returns an error if body is not the expected response of c.
+func (c check) compare(body []byte) error {
+	body = bytes.TrimSpace(body)
+	if c.Expect == "" {
+		if len(body) != 0 {
+			return fmt.Errorf("expected no response, got %s", body)
+		}
+		return nil
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("expected a response, got none")
+	}
+
+	var expect, got interface{}
+	if err := json.Unmarshal([]byte(c.Expect), &expect); err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		return fmt.Errorf("invalid JSON response: %s", body)
+	}
+
+	expectBatch, isBatch := expect.([]interface{})
+	gotBatch, ok := got.([]interface{})
+	if !isBatch {
+		if ok {
+			return fmt.Errorf("expected a single response, got %s", body)
+		}
+		return compareResponse(expect, got)
+	}
+	if !ok {
+		return fmt.Errorf("expected a batch response, got %s", body)
+	}
+	if len(expectBatch) != len(gotBatch) {
+		return fmt.Errorf("expected %v responses, got %v: %s",
+			len(expectBatch), len(gotBatch), body)
+	}
+
+	// The responses of a batch may be returned in any order, so match
+	// each expected response with any response.
+	matched := make([]bool, len(gotBatch))
+next:
+	for _, e := range expectBatch {
+		for i, g := range gotBatch {
+			if !matched[i] && compareResponse(e, g) == nil {
+				matched[i] = true
+				continue next
+			}
+		}
+		data, _ := json.Marshal(e)
+		return fmt.Errorf("missing response like %s in %s", data, body)
+	}
+	return nil
+}
+
+// compareResponse returns an error if got does not match the expected
+// Response object.
+func compareResponse(expect, got interface{}) error {
+	e := expect.(map[string]interface{})
+	g, ok := got.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("response is not an object: %v", got)
+	}
+	if g["jsonrpc"] != "2.0" {
+		return fmt.Errorf(`invalid "jsonrpc": %v`, g["jsonrpc"])
+	}
+	id, ok := g["id"]
+	if !ok {
+		return fmt.Errorf(`missing "id"`)
+	}
+	if !reflect.DeepEqual(e["id"], id) {
+		return fmt.Errorf(`expected "id" %v, got %v`, e["id"], id)
+	}
+	result, hasResult := g["result"]
+	resErr, hasError := g["error"]
+	if hasResult && hasError {
+		return fmt.Errorf(`contains both "result" and "error"`)
+	}
+	if expectResult, ok := e["result"]; ok {
+		if !hasResult {
+			return fmt.Errorf(`expected "result" %v, got "error" %v`,
+				expectResult, resErr)
+		}
+		if !reflect.DeepEqual(expectResult, result) {
+			return fmt.Errorf(`expected "result" %v, got %v`,
+				expectResult, result)
+		}
+		return nil
+	}
+	code := e["error"].(map[string]interface{})["code"]
+	errObj, ok := resErr.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf(`expected "error" with "code" %v, got %v`,
+			code, resErr)
+	}
+	if _, ok := errObj["message"].(string); !ok {
+		return fmt.Errorf(`"error" missing "message" string`)
+	}
+	if errObj["code"] != code {
+		return fmt.Errorf(`expected "error" "code" %v, got %v`,
+			code, errObj["code"])
+	}
+	return nil
+}
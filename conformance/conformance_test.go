@@ -0,0 +1,96 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdamSLevy/jsonrpc2/v14"
+	"github.com/stretchr/testify/assert"
+)
+
+func subtract(_ context.Context, params json.RawMessage) interface{} {
+	var a []float64
+	if err := json.Unmarshal(params, &a); err == nil && len(a) == 2 {
+		return a[0] - a[1]
+	}
+	var p struct{ Subtrahend, Minuend float64 }
+	if err := json.Unmarshal(params, &p); err != nil {
+		return jsonrpc2.ErrorInvalidParams(err)
+	}
+	return p.Minuend - p.Subtrahend
+}
+
+func sum(_ context.Context, params json.RawMessage) interface{} {
+	var a []float64
+	if err := json.Unmarshal(params, &a); err != nil {
+		return jsonrpc2.ErrorInvalidParams(err)
+	}
+	var s float64
+	for _, x := range a {
+		s += x
+	}
+	return s
+}
+
+var methods = jsonrpc2.MethodMap{
+	"subtract":     subtract,
+	"sum":          sum,
+	"notify_hello": func(context.Context, json.RawMessage) interface{} { return nil },
+	"get_data": func(context.Context, json.RawMessage) interface{} {
+		return []interface{}{"hello", 5}
+	},
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	h := jsonrpc2.HTTPRequestHandler(methods, nil)
+	r := RunHandler(h, Options{SpecMethods: true})
+	assert.True(r.Passed(), r.String())
+	assert.Len(r.Results, len(specChecks)+len(protocolChecks))
+	for _, res := range r.Results {
+		assert.True(res.Pass, "%v: %v", res.Name, res.Detail)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	r = Run(srv.URL, Options{})
+	assert.True(r.Passed(), r.String())
+	assert.Len(r.Results, len(protocolChecks))
+
+	// A server that always responds with the same Response.
+	r = RunHandler(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":1,"id":1}`))
+		}), Options{})
+	assert.False(r.Passed())
+	assert.Contains(r.String(), "FAIL: invalid JSON\n"+
+		`      expected "id" <nil>, got 1`)
+	assert.Contains(r.String(), "FAIL: method not found Notification\n"+
+		`      expected no response, got {"jsonrpc":"2.0","result":1,"id":1}`)
+	assert.Contains(r.String(), "WARN: unknown field")
+	assert.Contains(r.String(), "0 passed, 21 failed, 2 warnings")
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DecodePolicy controls which deviations from the JSON-RPC 2.0 Spec are
+// tolerated when decoding Requests and Responses from non-conforming peers.
+// The zero value is strict and rejects all deviations.
+//
+// Use WithDecodePolicy to set the DecodePolicy for the HTTPRequestHandler, or
+// set Client.DecodePolicy.
+type DecodePolicy struct {
+	// UnknownFields tolerates top level members that are not defined by
+	// the Spec, which are otherwise an error.
+	UnknownFields bool
+
+	// MissingVersion tolerates an omitted "jsonrpc" member, which is
+	// otherwise an error. A "jsonrpc" member that is present must still
+	// be exactly "2.0".
+	MissingVersion bool
+
+	// Warn, if not nil, is called with a Warning for each tolerated
+	// deviation.
+	Warn func(Warning)
+}
+
+// LenientDecodePolicy returns a DecodePolicy that tolerates all supported
+// deviations and calls warn, which may be nil, for each of them.
+func LenientDecodePolicy(warn func(Warning)) DecodePolicy {
+	return DecodePolicy{UnknownFields: true, MissingVersion: true, Warn: warn}
+}
+
+// Warning describes a deviation from the Spec that was tolerated by a
+// DecodePolicy.
+type Warning struct {
+	// Message describes the deviation, such as `unknown field "foo"`.
+	Message string
+
+	// Data is the raw JSON of the Request or Response that was decoded.
+	Data json.RawMessage
+}
+
+// String returns w.Message.
+func (w Warning) String() string {
+	return w.Message
+}
+
+// WithDecodePolicy returns a HandlerOption that sets the DecodePolicy used by
+// the HTTPRequestHandler to decode Requests.
+func WithDecodePolicy(p DecodePolicy) HandlerOption {
+	return func(h *handler) {
+		h.decode = p
+	}
+}
+
+// decodeOptions holds the configuration used to unmarshal a Request or
+// Response.
+type decodeOptions struct {
+	ids    IDPolicy
+	policy DecodePolicy
+
+	// version1 accepts JSON-RPC 1.0 messages. See WithVersion1.
+	version1 bool
+}
+
+// newDecoder returns a json.Decoder for data that disallows unknown fields
+// unless they are tolerated by o.
+func (o decodeOptions) newDecoder(data []byte) *json.Decoder {
+	d := json.NewDecoder(bytes.NewBuffer(data))
+	if !o.policy.UnknownFields {
+		d.DisallowUnknownFields()
+	}
+	return d
+}
+
+// checkVersion returns an error if the "jsonrpc" member, whose decoded value
+// is v, is not "2.0", unless it was omitted and o tolerates that. It returns
+// true if the message should be treated as JSON-RPC 1.0.
+func (o decodeOptions) checkVersion(data []byte, v string) (version1 bool,
+	_ error) {
+
+	if v == version {
+		return false, nil
+	}
+	if v == "" && (o.version1 || o.policy.MissingVersion) {
+		fields, err := topLevelFields(data)
+		if err != nil {
+			return false, err
+		}
+		if _, ok := fields["jsonrpc"]; !ok {
+			if o.version1 {
+				return true, nil
+			}
+			o.warn(data, `missing "jsonrpc" version`)
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf(`invalid "jsonrpc" version: %q`, v)
+}
+
+// checkUnknownFields calls o.policy.Warn for each top level member of data
+// that is not in known, if any unknown fields are tolerated by o.
+func (o decodeOptions) checkUnknownFields(data []byte, known ...string) error {
+	if !o.policy.UnknownFields || o.policy.Warn == nil {
+		return nil
+	}
+	fields, err := topLevelFields(data)
+	if err != nil {
+		return err
+	}
+	for _, k := range known {
+		delete(fields, k)
+	}
+	unknown := make([]string, 0, len(fields))
+	for k := range fields {
+		unknown = append(unknown, k)
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		o.warn(data, fmt.Sprintf("unknown field %q", k))
+	}
+	return nil
+}
+
+// warn calls o.policy.Warn, if not nil, with msg and data.
+func (o decodeOptions) warn(data []byte, msg string) {
+	if o.policy.Warn != nil {
+		o.policy.Warn(Warning{Message: msg, Data: data})
+	}
+}
+
+// topLevelFields returns the members of the JSON object in data.
+func topLevelFields(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	return fields, err
+}
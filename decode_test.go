@@ -0,0 +1,149 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var decodeRequestTests = []struct {
+	Name     string
+	Data     string
+	Policy   DecodePolicy
+	Err      string
+	Warnings []string
+}{{
+	Name: "strict unknown field",
+	Data: `{"jsonrpc":"2.0","method":"a","id":1,"x":1}`,
+	Err:  `json: unknown field "x"`,
+}, {
+	Name: "strict missing version",
+	Data: `{"method":"a","id":1}`,
+	Err:  `invalid "jsonrpc" version: ""`,
+}, {
+	Name:     "unknown fields",
+	Data:     `{"jsonrpc":"2.0","method":"a","id":1,"y":1,"x":1}`,
+	Policy:   DecodePolicy{UnknownFields: true},
+	Warnings: []string{`unknown field "x"`, `unknown field "y"`},
+}, {
+	Name:     "missing version",
+	Data:     `{"method":"a","id":1}`,
+	Policy:   DecodePolicy{MissingVersion: true},
+	Warnings: []string{`missing "jsonrpc" version`},
+}, {
+	Name:   "empty version",
+	Data:   `{"jsonrpc":"","method":"a","id":1}`,
+	Policy: DecodePolicy{MissingVersion: true},
+	Err:    `invalid "jsonrpc" version: ""`,
+}, {
+	Name:   "wrong version",
+	Data:   `{"jsonrpc":"1.0","method":"a","id":1}`,
+	Policy: DecodePolicy{MissingVersion: true},
+	Err:    `invalid "jsonrpc" version: "1.0"`,
+}, {
+	Name:   "missing method",
+	Data:   `{"id":1,"x":1}`,
+	Policy: DecodePolicy{UnknownFields: true, MissingVersion: true},
+	Err:    `missing "method"`,
+}}
+
+func TestDecodePolicyRequest(t *testing.T) {
+	for _, test := range decodeRequestTests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			var warnings []string
+			test.Policy.Warn = func(w Warning) {
+				assert.Equal(test.Data, string(w.Data))
+				warnings = append(warnings, w.String())
+			}
+			var req Request
+			err := req.unmarshalJSON([]byte(test.Data),
+				decodeOptions{policy: test.Policy})
+			if test.Err != "" {
+				assert.EqualError(err, test.Err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("a", req.Method)
+			assert.Equal(json.RawMessage(`1`), req.ID)
+			assert.Equal(test.Warnings, warnings)
+		})
+	}
+}
+
+func TestWithDecodePolicy(t *testing.T) {
+	assert := assert.New(t)
+	var warnings []string
+	h := HTTPRequestHandler(MethodMap{
+		"a": func(context.Context, json.RawMessage) interface{} {
+			return true
+		}}, nil, WithDecodePolicy(LenientDecodePolicy(func(w Warning) {
+		warnings = append(warnings, w.Message)
+	})))
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(
+		`{"method":"a","id":1,"x":1}`)))
+	assert.Equal(`{"jsonrpc":"2.0","result":true,"id":1}`+"\n",
+		w.Body.String())
+	assert.Equal([]string{`missing "jsonrpc" version`, `unknown field "x"`},
+		warnings)
+}
+
+func TestClientDecodePolicy(t *testing.T) {
+	assert := assert.New(t)
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct{ ID json.RawMessage }
+			json.NewDecoder(r.Body).Decode(&req)
+			w.Write([]byte(`{` + body + `"id":` + string(req.ID) + `}`))
+		}))
+	defer srv.Close()
+
+	var c Client
+	var result string
+	body = `"result":"ok","node":"x",`
+	assert.EqualError(c.Request(nil, srv.URL, "a", nil, &result),
+		`json: unknown field "node"`)
+
+	var warnings []string
+	c.DecodePolicy = LenientDecodePolicy(func(w Warning) {
+		warnings = append(warnings, w.Message)
+	})
+	assert.NoError(c.Request(nil, srv.URL, "a", nil, &result))
+	assert.Equal("ok", result)
+	assert.Equal([]string{`missing "jsonrpc" version`,
+		`unknown field "node"`}, warnings)
+
+	warnings = nil
+	body = `"jsonrpc":"2.0","error":{"code":-32601,"message":"x"},"node":1,`
+	err := c.Request(nil, srv.URL, "a", nil, &result)
+	assert.Equal(Error{Code: ErrorCodeMethodNotFound, Message: "x"}, err)
+	assert.Equal([]string{`unknown field "node"`}, warnings)
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrorRule maps err to an Error, or returns false if it does not apply.
+type ErrorRule func(err error) (Error, bool)
+
+// ErrorMapper maps errors returned by MethodFuncs that are not an Error to an
+// Error using the first ErrorRule that applies. See WithErrorMapper.
+type ErrorMapper []ErrorRule
+
+// Map returns the Error of the first ErrorRule in m that applies to err, or
+// false if none do.
+func (m ErrorMapper) Map(err error) (Error, bool) {
+	for _, rule := range m {
+		if e, ok := rule(err); ok {
+			return e, true
+		}
+	}
+	return Error{}, false
+}
+
+// WithErrorMapper returns a HandlerOption that allows MethodFuncs to return
+// any error, which is mapped to an Error using the given rules, in order.
+//
+// A mapped Error must be valid like any Error returned by a MethodFunc,
+// otherwise a panic occurs, except that server error codes, such as
+// ErrorCodeTimeout, are allowed. If no rule applies, an Internal Error without
+// any Data is returned, and the error is logged, so that no implementation
+// details are revealed to the client. Use ErrorDefault as the last rule to
+// override this.
+//
+// Errors that are, or wrap, an Error are returned as is, without consulting
+// the rules.
+func WithErrorMapper(rules ...ErrorRule) HandlerOption {
+	return func(h *handler) {
+		// Ensure h.errors is not nil, even if there are no rules, so
+		// that unmapped errors are not treated as a panic.
+		h.errors = append(append(ErrorMapper{}, h.errors...), rules...)
+	}
+}
+
+// ErrorIs returns an ErrorRule that maps any error for which errors.Is(err,
+// target) is true to e.
+//
+// For example:
+//
+//	ErrorIs(sql.ErrNoRows, NewError(404, "not found", nil))
+func ErrorIs(target error, e Error) ErrorRule {
+	return func(err error) (Error, bool) {
+		if errors.Is(err, target) {
+			return e, true
+		}
+		return Error{}, false
+	}
+}
+
+// ErrorAs returns an ErrorRule that maps any error for which errors.As
+// finds an error of type T using f, which must be a func(T) Error, where T
+// implements error.
+//
+// For example:
+//
+//	ErrorAs(func(err *ValidationError) Error {
+//	        return ErrorInvalidParams(err.Fields)
+//	})
+//
+// This panics if f is not a func(T) Error.
+func ErrorAs(f interface{}) ErrorRule {
+	fn := reflect.ValueOf(f)
+	typ := fn.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if typ.Kind() != reflect.Func ||
+		typ.NumIn() != 1 || !typ.In(0).Implements(errorType) ||
+		typ.NumOut() != 1 || typ.Out(0) != reflect.TypeOf(Error{}) {
+		panic(fmt.Errorf("ErrorAs: %T is not a func(error type) Error", f))
+	}
+	target := typ.In(0)
+	return func(err error) (Error, bool) {
+		ptr := reflect.New(target)
+		if !errors.As(err, ptr.Interface()) {
+			return Error{}, false
+		}
+		return fn.Call([]reflect.Value{ptr.Elem()})[0].Interface().(Error),
+			true
+	}
+}
+
+// ErrorDefault returns an ErrorRule that always applies, mapping any error
+// using f. It should be the last rule.
+func ErrorDefault(f func(err error) Error) ErrorRule {
+	return func(err error) (Error, bool) {
+		return f(err), true
+	}
+}
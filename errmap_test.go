@@ -0,0 +1,143 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validationError is a domain error for testing ErrorAs.
+type validationError struct {
+	Field string
+}
+
+func (err *validationError) Error() string {
+	return "invalid " + err.Field
+}
+
+func TestErrorMapper(t *testing.T) {
+	assert := assert.New(t)
+	m := ErrorMapper{
+		ErrorIs(sql.ErrNoRows, NewError(404, "not found", nil)),
+		ErrorIs(os.ErrNotExist, NewError(410, "gone", nil)),
+		ErrorAs(func(err *validationError) Error {
+			return ErrorInvalidParams(err.Field)
+		}),
+	}
+
+	e, ok := m.Map(fmt.Errorf("query: %w", sql.ErrNoRows))
+	assert.True(ok)
+	assert.Equal(NewError(404, "not found", nil), e)
+
+	_, err := os.Open("does-not-exist")
+	e, ok = m.Map(err)
+	assert.True(ok)
+	assert.Equal(ErrorCode(410), e.Code)
+
+	e, ok = m.Map(fmt.Errorf("wrapped: %w", &validationError{"name"}))
+	assert.True(ok)
+	assert.Equal(ErrorInvalidParams("name"), e)
+
+	_, ok = m.Map(errors.New("unmapped"))
+	assert.False(ok)
+
+	m = append(m, ErrorDefault(func(err error) Error {
+		return NewError(500, err.Error(), nil)
+	}))
+	e, ok = m.Map(errors.New("unmapped"))
+	assert.True(ok)
+	assert.Equal(NewError(500, "unmapped", nil), e)
+
+	assert.Panics(func() { ErrorAs(func(string) Error { return Error{} }) })
+	assert.Panics(func() { ErrorAs(func(error) error { return nil }) })
+	assert.Panics(func() { ErrorAs(nil) })
+}
+
+func TestWithErrorMapper(t *testing.T) {
+	assert := assert.New(t)
+	methods := MethodMap{
+		"error": func(_ context.Context, params json.RawMessage) interface{} {
+			var p []string
+			json.Unmarshal(params, &p)
+			switch p[0] {
+			case "no rows":
+				return sql.ErrNoRows
+			case "validation":
+				return fmt.Errorf("%w", &validationError{"a"})
+			case "error":
+				return fmt.Errorf("wrapped: %w",
+					NewError(1, "wrapped", nil))
+			case "reserved":
+				return os.ErrNotExist
+			}
+			return errors.New("secret details")
+		},
+	}
+	var buf bytes.Buffer
+	h := HTTPRequestHandler(methods, log.New(&buf, "", 0),
+		WithErrorMapper(
+			ErrorIs(sql.ErrNoRows, NewError(404, "not found", nil)),
+			ErrorIs(os.ErrNotExist, NewError(ErrorCodeMethodNotFound,
+				"misuse", nil)),
+			ErrorAs(func(err *validationError) Error {
+				return ErrorInvalidParams(err.Field)
+			})))
+	serve := func(kind string) Error {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+			`{"jsonrpc":"2.0","method":"error","params":["`+kind+`"],"id":1}`)))
+		var res Response
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		return res.Error
+	}
+
+	assert.Equal(NewError(404, "not found", nil), serve("no rows"))
+	assert.Equal(ErrorInvalidParams("a"), serve("validation"))
+	assert.Equal(NewError(1, "wrapped", nil), serve("error"))
+
+	// A mapped Error is validated like any returned Error.
+	assert.Equal(ErrorCodeInternal, serve("reserved").Code)
+
+	// Unmapped errors use a safe default, and are logged.
+	buf.Reset()
+	e := serve("other")
+	assert.Equal(ErrorCodeInternal, e.Code)
+	assert.Nil(e.Data)
+	assert.Contains(buf.String(), "unmapped error returned by method")
+	assert.Contains(buf.String(), `error="secret details"`)
+
+	// Without any rules, unmapped errors still use the safe default.
+	h = HTTPRequestHandler(methods, log.New(&buf, "", 0), WithErrorMapper())
+	assert.Equal(ErrorCodeInternal, serve("other").Code)
+}
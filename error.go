@@ -68,17 +68,61 @@ const (
 	ErrorCodeMaxReserved ErrorCode = -32000
 )
 
+// Implementation-defined server error codes and messages, which are reserved
+// by the Spec for use by the server implementation, such as this package or
+// server infrastructure. MethodFuncs may not return these, see ServerError.
+const (
+	// ErrorCodeMinServer is the minimum server error code.
+	ErrorCodeMinServer ErrorCode = -32099
+
+	// ErrorMessageServer is the message of any server error code not
+	// defined below.
+	ErrorMessageServer = "Server error"
+
+	// ErrorCodeTimeout means a call did not complete in time.
+	ErrorCodeTimeout    ErrorCode = -32000
+	ErrorMessageTimeout           = "Timeout"
+
+	// ErrorCodeRateLimited means a call was rejected because the client
+	// exceeded a rate limit.
+	ErrorCodeRateLimited    ErrorCode = -32001
+	ErrorMessageRateLimited           = "Rate limited"
+
+	// ErrorCodeUnauthorized means a call was rejected because the client
+	// is not authenticated or not permitted to call the method.
+	ErrorCodeUnauthorized    ErrorCode = -32002
+	ErrorMessageUnauthorized           = "Unauthorized"
+
+	// ErrorCodeOverloaded means a call was rejected because the server is
+	// overloaded.
+	ErrorCodeOverloaded    ErrorCode = -32003
+	ErrorMessageOverloaded           = "Overloaded"
+
+	// ErrorCodeMaxServer is the maximum server error code.
+	ErrorCodeMaxServer ErrorCode = -32000
+)
+
 // IsReserved returns true if c is within the reserved error code range:
 //      [LowestReservedErrorCode, HighestReservedErrorCode]
 func (c ErrorCode) IsReserved() bool {
 	return ErrorCodeMinReserved <= c && c <= ErrorCodeMaxReserved
 }
 
+// IsServerError returns true if c is within the implementation-defined server
+// error range:
+//      [ErrorCodeMinServer, ErrorCodeMaxServer]
+func (c ErrorCode) IsServerError() bool {
+	return ErrorCodeMinServer <= c && c <= ErrorCodeMaxServer
+}
+
 func (c ErrorCode) String() string {
 	if !c.IsReserved() {
 		return fmt.Sprintf("ErrorCode{%v}", int(c))
 	}
 	msg := "reserved"
+	if c.IsServerError() {
+		msg = ErrorMessageServer
+	}
 	switch c {
 	case ErrorCodeParse:
 		msg = ErrorMessageParse
@@ -90,6 +134,14 @@ func (c ErrorCode) String() string {
 		msg = ErrorMessageInvalidParams
 	case ErrorCodeInternal:
 		msg = ErrorMessageInternal
+	case ErrorCodeTimeout:
+		msg = ErrorMessageTimeout
+	case ErrorCodeRateLimited:
+		msg = ErrorMessageRateLimited
+	case ErrorCodeUnauthorized:
+		msg = ErrorMessageUnauthorized
+	case ErrorCodeOverloaded:
+		msg = ErrorMessageOverloaded
 	}
 	return fmt.Sprintf("ErrorCode{%v:%q}", int(c), msg)
 }
@@ -42,3 +42,30 @@ func TestError(t *testing.T) {
 	var err Error
 	assert.Implements(&e, err)
 }
+
+func TestErrorCodeIsServerError(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(ErrorCodeMinServer.IsServerError())
+	assert.True(ErrorCodeMaxServer.IsServerError())
+	assert.True(ErrorCodeMinServer.IsReserved())
+	assert.False((ErrorCodeMinServer - 1).IsServerError())
+	assert.False((ErrorCodeMaxServer + 1).IsServerError())
+	assert.False(ErrorCodeInternal.IsServerError())
+}
+
+func TestErrorCodeString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`ErrorCode{1}`, ErrorCode(1).String())
+	assert.Equal(`ErrorCode{-32603:"Internal error"}`,
+		ErrorCodeInternal.String())
+	assert.Equal(`ErrorCode{-32000:"Timeout"}`, ErrorCodeTimeout.String())
+	assert.Equal(`ErrorCode{-32001:"Rate limited"}`,
+		ErrorCodeRateLimited.String())
+	assert.Equal(`ErrorCode{-32002:"Unauthorized"}`,
+		ErrorCodeUnauthorized.String())
+	assert.Equal(`ErrorCode{-32003:"Overloaded"}`,
+		ErrorCodeOverloaded.String())
+	assert.Equal(`ErrorCode{-32050:"Server error"}`,
+		ErrorCode(-32050).String())
+	assert.Equal(`ErrorCode{-32100:"reserved"}`, ErrorCode(-32100).String())
+}
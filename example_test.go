@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 
@@ -114,7 +115,12 @@ func getData(_ context.Context, _ json.RawMessage) interface{} {
 // This example makes all of the calls from the examples in the JSON-RPC 2.0
 // specification and prints them in a similar format.
 func Example() {
-	// Start the server.
+	// Start the server. Listen before serving in the background so that
+	// the requests below cannot race the server startup.
+	l, err := net.Listen("tcp", ":18888")
+	if err != nil {
+		panic(err)
+	}
 	go func() {
 		// Register RPC methods.
 		methods := jsonrpc2.MethodMap{
@@ -125,7 +131,7 @@ func Example() {
 		}
 		jsonrpc2.DebugMethodFunc = true
 		handler := jsonrpc2.HTTPRequestHandler(methods, log.New(os.Stdout, "", 0))
-		http.ListenAndServe(":18888", handler)
+		http.Serve(l, handler)
 	}()
 
 	// Make requests.
@@ -0,0 +1,247 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package jsonrpc2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fuzzSeeds are inputs for all fuzz tests in addition to the requests and
+// responses recorded in testdata/requests.jsonl.
+var fuzzSeeds = []string{
+	``,
+	`null`,
+	`[]`,
+	`[1,2,3]`,
+	`[[]]`,
+	`{"jsonrpc":"2.0","method":1,"params":"bar"}`,
+	`{"jsonrpc":"2.0","method":"foobar,"params":"bar","baz]`,
+	`{"jsonrpc":"2.0","method":"echo","params":[1],"id":1e5}`,
+	`{"jsonrpc":"2.0","method":"echo","id":{}}`,
+	`{"jsonrpc":"2.0","method":"echo","id":.5}`,
+	`{"jsonrpc":"2.0","result":null,"error":null,"id":1}`,
+	`{"jsonrpc":"2.0","error":{"code":-32600,"message":"m"},"id":null}`,
+	`[{"jsonrpc":"2.0","method":"echo","id":"1"},{"jsonrpc":"2.0","method":"echo"}]`,
+}
+
+// addFuzzSeeds adds the fuzzSeeds and the recorded requests and responses to
+// f.
+func addFuzzSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	file, err := os.Open("testdata/requests.jsonl")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer file.Close()
+	s := bufio.NewScanner(file)
+	var batch [][]byte
+	for s.Scan() {
+		var ex Exchange
+		if err := json.Unmarshal(s.Bytes(), &ex); err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(ex.Request))
+		if ex.Response != nil {
+			f.Add([]byte(ex.Response))
+		}
+		batch = append(batch, ex.Request)
+	}
+	f.Add(append(append([]byte("["), bytes.Join(batch, []byte(","))...), ']'))
+}
+
+func FuzzRequestUnmarshalJSON(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req Request
+		if req.UnmarshalJSON(data) != nil {
+			return
+		}
+		// Any accepted Request must round trip.
+		data2, err := req.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON(): %v", err)
+		}
+		var req2 Request
+		if err := req2.UnmarshalJSON(data2); err != nil {
+			t.Fatalf("UnmarshalJSON(%s): %v", data2, err)
+		}
+		data3, err := req2.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON(): %v", err)
+		}
+		if !bytes.Equal(data2, data3) {
+			t.Fatalf("round trip: %s != %s", data2, data3)
+		}
+		if req.Method != req2.Method {
+			t.Fatalf("method: %q != %q", req.Method, req2.Method)
+		}
+	})
+}
+
+func FuzzResponseUnmarshalJSON(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var result, id json.RawMessage
+		res := Response{Result: &result, ID: &id}
+		if res.UnmarshalJSON(data) != nil {
+			return
+		}
+		if res.HasError() && result != nil {
+			t.Fatalf(`accepted both "result" and "error": %s`, data)
+		}
+	})
+}
+
+func FuzzValidateID(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, id []byte) {
+		if !json.Valid(id) {
+			return
+		}
+		var v interface{}
+		json.Unmarshal(id, &v)
+		err := validateID(bytes.TrimSpace(id))
+		switch v := v.(type) {
+		case nil, string:
+			if err != nil {
+				t.Fatalf("rejected %s: %v", id, err)
+			}
+		case float64:
+			// Only Numbers with a fractional part are rejected.
+			if err != nil &&
+				!strings.HasSuffix(err.Error(), "has a fractional part") {
+				t.Fatalf("rejected %s: %v", id, err)
+			}
+			if err == nil && v != math.Trunc(v) {
+				t.Fatalf("accepted fractional %s", id)
+			}
+		default:
+			if err == nil {
+				t.Fatalf("accepted %s", id)
+			}
+		}
+	})
+}
+
+func FuzzHTTPRequestHandler(f *testing.F) {
+	addFuzzSeeds(f)
+	h := HTTPRequestHandler(MethodMap{
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		},
+		"subtract": func(_ context.Context, params json.RawMessage) interface{} {
+			var a [2]float64
+			if err := json.Unmarshal(params, &a); err != nil {
+				return ErrorInvalidParams(err)
+			}
+			return a[0] - a[1]
+		},
+	}, nil)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewReader(body)))
+		out := bytes.TrimSpace(w.Body.Bytes())
+
+		// Count the Requests and Notifications in a valid body.
+		var requests, notifications int
+		if rawReqs, err := splitBatch(body); err == nil && json.Valid(body) {
+			for _, rawReq := range rawReqs {
+				var req Request
+				if json.Unmarshal(rawReq, &req) != nil {
+					requests++
+					continue
+				}
+				if req.ID.(json.RawMessage) == nil {
+					notifications++
+				} else {
+					requests++
+				}
+			}
+		}
+
+		if len(out) == 0 {
+			if requests > 0 {
+				t.Fatalf("no response to %s", body)
+			}
+			return
+		}
+		if !json.Valid(out) {
+			t.Fatalf("invalid JSON response %s to %s", out, body)
+		}
+		if requests == 0 && notifications > 0 {
+			t.Fatalf("response %s to notifications %s", out, body)
+		}
+		rawRess, err := splitBatch(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requests > 0 && len(rawRess) > requests {
+			t.Fatalf("%v responses to %v requests: %s",
+				len(rawRess), requests, body)
+		}
+		for _, rawRes := range rawRess {
+			var result, id json.RawMessage
+			res := Response{Result: &result, ID: &id}
+			if err := json.Unmarshal(rawRes, &res); err != nil {
+				t.Fatalf("invalid Response %s: %v", rawRes, err)
+			}
+		}
+	})
+}
+
+func FuzzCodecToJSON(f *testing.F) {
+	for _, seed := range codecToJSONTests {
+		data, _ := hex.DecodeString(seed.Hex)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, codec := range []Codec{MessagePackCodec, CBORCodec} {
+			out, err := codec.ToJSON(data)
+			if err != nil {
+				continue
+			}
+			if !json.Valid(out) {
+				t.Fatalf("%v: invalid JSON: %s", codec.ContentType(), out)
+			}
+			// Any converted JSON must convert back.
+			if _, err := codec.FromJSON(out); err != nil {
+				t.Fatalf("%v: FromJSON(%s): %v",
+					codec.ContentType(), out, err)
+			}
+		}
+	})
+}
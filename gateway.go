@@ -0,0 +1,308 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Route associates a method name Pattern with the URL of a backend JSON-RPC
+// 2.0 server for the HTTPGatewayHandler.
+//
+// A Pattern ending in "*" matches any method name with the preceding prefix,
+// for example "eth_*" or "admin.*". Otherwise a Pattern only matches the
+// exact method name. The Pattern "*" matches any method name.
+type Route struct {
+	Pattern string
+	URL     string
+}
+
+// match returns true if method matches r.Pattern.
+func (r Route) match(method string) bool {
+	if prefix := strings.TrimSuffix(r.Pattern, "*"); prefix != r.Pattern {
+		return strings.HasPrefix(method, prefix)
+	}
+	return method == r.Pattern
+}
+
+// gateway forwards Requests to backends according to its routes.
+type gateway struct {
+	routes []Route
+	c      *Client
+	h      *handler
+}
+
+// HTTPGatewayHandler returns an http.HandlerFunc that forwards each Request
+// to the backend of the first Route whose Pattern matches its method name.
+//
+// The returned http.HandlerFunc handles single and batch requests and
+// Notifications like the HTTPRequestHandler, and catches all defined protocol
+// errors locally. A Method not found Error is returned for any Request that
+// does not match a Route.
+//
+// A batch request is split into a batch request for each backend, which are
+// forwarded concurrently. The Responses are reassembled in the order of the
+// original Requests, with their original IDs. The IDs sent to each backend
+// are replaced, so that the Responses can be matched to their Requests even
+// if the original IDs are not unique.
+//
+// If a backend cannot be reached or does not respond with a valid Response
+// for a forwarded Request, an Internal Error is returned for that Request and
+// the cause is logged using lgr. If lgr is nil, the default Logger from the
+// log package is used.
+//
+// Requests are forwarded using c, which may be nil to use a zero Client. The
+// c.Header, c.BasicAuth and c.Breaker are used for each forwarded batch.
+//
+// This will panic if a Route Pattern contains a "*" other than as the last
+// character.
+//
+// Any opts are applied as for HTTPRequestHandler, see HandlerOption.
+func HTTPGatewayHandler(routes []Route, c *Client, lgr Logger,
+	opts ...HandlerOption) http.HandlerFunc {
+	for _, r := range routes {
+		if strings.Contains(strings.TrimSuffix(r.Pattern, "*"), "*") {
+			panic(fmt.Errorf("invalid route pattern: %v", r.Pattern))
+		}
+	}
+	if c == nil {
+		c = new(Client)
+	}
+	g := gateway{routes: routes, c: c}
+	h := handler{log: newEventLog(lgr), process: g.forward}
+	g.h = &h
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	return h.ServeHTTP
+}
+
+// route returns the URL of the backend for method, or false if no Route
+// matches.
+func (g *gateway) route(method string) (string, bool) {
+	for _, r := range g.routes {
+		if r.match(method) {
+			return r.URL, true
+		}
+	}
+	return "", false
+}
+
+// forwarded is a Request to be forwarded to a backend, along with the index
+// and ID of the original Request.
+type forwarded struct {
+	req   Request
+	index int
+	id    json.RawMessage
+}
+
+// forward routes each Request in rawReqs to a backend and returns the
+// Responses in order, omitting any for Notifications.
+func (g *gateway) forward(ctx context.Context,
+	rawReqs []json.RawMessage) BatchResponse {
+
+	responses := make([]*Response, len(rawReqs))
+	backends := make(map[string][]forwarded)
+	for i, rawReq := range rawReqs {
+		req, err := g.h.unmarshalRequest(rawReq)
+		if err != nil {
+			res := invalidRequestResponse(req, err)
+			responses[i] = &res
+			continue
+		}
+		id := req.ID.(json.RawMessage)
+		url, ok := g.route(req.Method)
+		if !ok {
+			if id != nil {
+				responses[i] = &Response{
+					Error:    errorMethodNotFound(req.Method),
+					ID:       id,
+					version1: req.version1,
+				}
+			}
+			continue
+		}
+		backends[url] = append(backends[url], forwarded{req, i, id})
+	}
+
+	var wg sync.WaitGroup
+	for url, fwds := range backends {
+		wg.Add(1)
+		go func(url string, fwds []forwarded) {
+			defer wg.Done()
+			g.forwardBackend(ctx, url, fwds, responses)
+		}(url, fwds)
+	}
+	wg.Wait()
+
+	batch := make(BatchResponse, 0, len(rawReqs))
+	for _, res := range responses {
+		if res != nil {
+			batch = append(batch, *res)
+		}
+	}
+	return batch
+}
+
+// forwardBackend sends fwds to the backend at url and sets the Response for
+// each forwarded Request in responses, using the original ID.
+func (g *gateway) forwardBackend(ctx context.Context, url string,
+	fwds []forwarded, responses []*Response) {
+
+	// Replace the ID of each Request with its index in fwds.
+	reqs := make(BatchRequest, len(fwds))
+	for i, fwd := range fwds {
+		reqs[i] = Request{Method: fwd.req.Method}
+		if params := fwd.req.Params.(json.RawMessage); params != nil {
+			reqs[i].Params = params
+		}
+		if fwd.id != nil {
+			reqs[i].ID = i
+		}
+	}
+
+	found, err := g.send(ctx, url, reqs)
+	for i, fwd := range fwds {
+		if fwd.id == nil {
+			continue
+		}
+		res, ok := found[i]
+		if !ok {
+			res = Response{Error: errorInternal(nil)}
+			if err == nil {
+				err = fmt.Errorf("missing Response for ID %v", i)
+			}
+		}
+		res.ID = fwd.id
+		res.version1 = fwd.req.version1
+		responses[fwd.index] = &res
+	}
+	if err != nil {
+		g.h.log.error("gateway backend failed",
+			FieldURL, url, FieldError, err)
+	}
+}
+
+// send reqs to the backend at url as a single Request, or a batch request if
+// there is more than one, and return the Responses by ID.
+func (g *gateway) send(ctx context.Context, url string,
+	reqs BatchRequest) (map[int]Response, error) {
+
+	var reqData []byte
+	var err error
+	if len(reqs) == 1 {
+		reqData, err = reqs[0].MarshalJSON()
+	} else {
+		reqData, err = json.Marshal(reqs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trial, err := g.c.Breaker.allow(url, "")
+	if err != nil {
+		return nil, err
+	}
+	httpRes, body, err := g.c.post(ctx, url, reqData)
+	if err == nil {
+		var rawRess []json.RawMessage
+		rawRess, err = splitBatch(body)
+		if err != nil {
+			err = newErrorUnexpectedHTTPResponse(err, body, httpRes)
+		} else {
+			g.c.Breaker.record(ctx, url, "", trial, nil)
+			return parseBackendResponses(rawRess,
+				g.c.decodeOptions()), nil
+		}
+	}
+	g.c.Breaker.record(ctx, url, "", trial, err)
+	return nil, err
+}
+
+// splitBatch returns the elements of the JSON array in body, or body itself
+// if it is not an array. If body is empty, so is the returned slice.
+func splitBatch(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if body[0] != '[' {
+		return []json.RawMessage{body}, nil
+	}
+	var rawRess []json.RawMessage
+	if err := json.Unmarshal(body, &rawRess); err != nil {
+		return nil, err
+	}
+	return rawRess, nil
+}
+
+// parseBackendResponses returns the valid Responses in rawRess by their
+// integer ID, decoded using o.
+func parseBackendResponses(rawRess []json.RawMessage,
+	o decodeOptions) map[int]Response {
+
+	found := make(map[int]Response, len(rawRess))
+	for _, rawRes := range rawRess {
+		res, ok := parseBackendResponse(rawRes, o)
+		if !ok {
+			continue
+		}
+		var id *int
+		if json.Unmarshal(res.ID.(json.RawMessage), &id) != nil ||
+			id == nil {
+			continue
+		}
+		found[*id] = res
+	}
+	return found
+}
+
+// parseBackendResponse parses rawRes into a Response, or returns false if it
+// is not valid. The Result, Error.Data and ID are kept as json.RawMessage so
+// that they can be forwarded exactly.
+func parseBackendResponse(rawRes json.RawMessage,
+	o decodeOptions) (Response, bool) {
+
+	var result, id json.RawMessage
+	res := Response{Result: &result, ID: &id}
+	if err := json.Unmarshal(rawRes, &responseUnmarshaler{&res, o}); err != nil {
+		return Response{}, false
+	}
+	res.ID = id
+	res.Result = result
+	if res.HasError() {
+		var e struct {
+			Error struct{ Data json.RawMessage }
+		}
+		json.Unmarshal(rawRes, &e)
+		if e.Error.Data != nil {
+			res.Error.Data = e.Error.Data
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPGatewayHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	echo := func(name string) MethodFunc {
+		return func(_ context.Context, params json.RawMessage) interface{} {
+			return []interface{}{name, params}
+		}
+	}
+	eth := httptest.NewServer(HTTPRequestHandler(MethodMap{
+		"eth_a": echo("eth"),
+		"eth_b": echo("eth"),
+		"eth_error": func(context.Context, json.RawMessage) interface{} {
+			return NewError(1, "eth", json.RawMessage(`1.50`))
+		},
+	}, nil))
+	defer eth.Close()
+	admin := httptest.NewServer(HTTPRequestHandler(MethodMap{
+		"admin.a": echo("admin"),
+	}, nil))
+	defer admin.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	var buf bytes.Buffer
+	g := HTTPGatewayHandler([]Route{
+		{"eth_*", eth.URL},
+		{"admin.*", admin.URL},
+		{"down", down.URL},
+	}, nil, log.New(&buf, "", 0))
+
+	post := func(body string) string {
+		w := httptest.NewRecorder()
+		g(w, httptest.NewRequest(http.MethodPost, "/",
+			strings.NewReader(body)))
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	assert.Equal(`{"jsonrpc":"2.0","result":["eth",[1]],"id":"a"}`,
+		post(`{"jsonrpc":"2.0","method":"eth_a","params":[1],"id":"a"}`))
+
+	assert.Equal(`[`+
+		`{"jsonrpc":"2.0","result":["admin",null],"id":1},`+
+		`{"jsonrpc":"2.0","result":["eth",{"x":1}],"id":1},`+
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":"other"},"id":3},`+
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"json: unknown field \"foo\""},"id":null},`+
+		`{"jsonrpc":"2.0","result":["eth",null],"id":1.0},`+
+		`{"jsonrpc":"2.0","error":{"code":1,"message":"eth","data":1.50},"id":null}`+
+		`]`,
+		post(`[
+		{"jsonrpc":"2.0","method":"admin.a","id":1},
+		{"jsonrpc":"2.0","method":"eth_a","params":{"x":1},"id":1},
+		{"jsonrpc":"2.0","method":"eth_b"},
+		{"jsonrpc":"2.0","method":"other","id":3},
+		{"jsonrpc":"2.0","method":"unrouted"},
+		{"foo":"boo"},
+		{"jsonrpc":"2.0","method":"eth_b","id":1.0},
+		{"jsonrpc":"2.0","method":"eth_error","id":null}
+		]`))
+	assert.Empty(buf.String())
+
+	assert.Equal("",
+		post(`[{"jsonrpc":"2.0","method":"eth_a"},{"jsonrpc":"2.0","method":"other"}]`))
+
+	assert.Equal(`[`+
+		`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":1},`+
+		`{"jsonrpc":"2.0","result":["eth",null],"id":2}`+
+		`]`,
+		post(`[
+		{"jsonrpc":"2.0","method":"down","id":1},
+		{"jsonrpc":"2.0","method":"eth_a","id":2}
+		]`))
+	assert.Contains(buf.String(),
+		"jsonrpc2: gateway backend failed url="+down.URL)
+
+	assert.Panics(func() {
+		HTTPGatewayHandler([]Route{{Pattern: "a*b"}}, nil, nil)
+	})
+}
@@ -21,16 +21,59 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 )
 
+// HandlerOption configures optional behavior of the http.HandlerFunc returned
+// by HTTPRequestHandler, HTTPGatewayHandler or HTTPReplayHandler.
+//
+// HandlerOptions that affect how MethodFuncs are called have no effect on the
+// HTTPGatewayHandler and HTTPReplayHandler, since they do not call any
+// MethodFuncs.
+type HandlerOption func(*handler)
+
+// handler holds the MethodMap, Logger and any configuration set by
+// HandlerOptions for an http.HandlerFunc returned by HTTPRequestHandler.
+type handler struct {
+	methods  MethodMap
+	log      eventLog
+	limits   Limits
+	status   StatusPolicy
+	idPolicy IDPolicy
+	decode   DecodePolicy
+	version1 bool
+	codecs   []Codec
+
+	// compression is nil unless set by WithCompression.
+	compression *Compression
+
+	metrics metricsHook
+	tracer  traceHook
+
+	// access is nil unless set by WithAccessLog.
+	access *accessLog
+
+	panics panicOptions
+
+	// errors is nil unless set by WithErrorMapper.
+	errors ErrorMapper
+
+	middleware []Middleware
+
+	// process returns the Responses for rawReqs, omitting any for
+	// Notifications. If nil, h.processRequests is used.
+	process func(ctx context.Context,
+		rawReqs []json.RawMessage) BatchResponse
+}
+
 // HTTPRequestHandler returns an http.HandlerFunc for the given methods.
 //
 // The returned http.HandlerFunc efficiently handles any conforming single or
@@ -49,47 +92,181 @@ import (
 //
 // The handler will use lgr to log any errors and debug information, if
 // DebugMethodFunc is true. If lgr is nil, the default Logger from the log
-// package is used.
-func HTTPRequestHandler(methods MethodMap, lgr Logger) http.HandlerFunc {
+// package is used. Use WithEventLogger to receive structured Events instead.
+//
+// Any opts are applied in order and may be used to configure optional
+// behavior, such as Limits or a StatusPolicy.
+func HTTPRequestHandler(methods MethodMap, lgr Logger,
+	opts ...HandlerOption) http.HandlerFunc {
 	for name := range methods {
 		if strings.HasPrefix(name, "rpc.") {
 			panic(fmt.Errorf("invalid method name: %v", name))
 		}
 	}
-	if lgr == nil {
-		lgr = log.New(os.Stderr, "", log.LstdFlags)
+	h := handler{methods: methods, log: newEventLog(lgr)}
+	h.process = h.processRequests
+	for _, opt := range opts {
+		opt(&h)
 	}
 
-	return func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		res := handle(methods, req, lgr)
-		if req.Context().Err() != nil || res == nil {
-			return
-		}
-		// We should never have a JSON encoding related error because
-		// MethodFunc.call() already Marshaled any user provided Data
-		// or Result, and everything else is marshalable.
-		//
-		// However an error can be returned related to w.Write, which
-		// there is nothing we can do about, so we just log it here.
-		enc := json.NewEncoder(w)
-		if err := enc.Encode(res); err != nil {
-			lgr.Printf("req.Body.Write(): %v", err)
+	return h.ServeHTTP
+}
+
+// ServeHTTP handles a JSON-RPC 2.0 http.Request and writes any Response or
+// BatchResponse to w.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCodec, resCodec := negotiate(req, h.codecs)
+	w.Header().Set("Content-Type", resCodec.ContentType())
+	if len(h.codecs) > 0 {
+		w.Header().Add("Vary", "Accept")
+	}
+	if h.compression != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if h.access != nil {
+		// Log the calls once the size of the http.Response is known.
+		var calls *accessCalls
+		req, calls = h.access.withCalls(req)
+		cw := &countingResponseWriter{ResponseWriter: w}
+		w = cw
+		defer func() { h.access.write(h.log, calls, cw.n) }()
+	}
+	res, status := h.handle(req, reqCodec)
+	if req.Context().Err() != nil {
+		return
+	}
+	if status == 0 {
+		status = h.status.statusCode(res)
+	}
+
+	// We should never have a JSON encoding related error because
+	// MethodFunc.call() already Marshaled any user provided Data or
+	// Result, and everything else is marshalable.
+	//
+	// However an error can be returned related to converting to the
+	// resCodec, compressing, or w.Write, which there is nothing we can do
+	// about, so we just log it here.
+	var data []byte
+	if res != nil {
+		var err error
+		data, err = h.encodeResponse(w.Header(), req, resCodec, res)
+		if err != nil {
+			h.log.error("encoding response failed",
+				FieldRemoteAddr, req.RemoteAddr, FieldError, err)
 		}
 	}
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+	if len(data) == 0 {
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		h.log.error("writing response failed",
+			FieldRemoteAddr, req.RemoteAddr, FieldError, err)
+	}
 }
 
-// handle an http.Request for the given methods.
-func handle(methods MethodMap, req *http.Request, lgr Logger) interface{} {
-	// Read all bytes of HTTP request body.
-	reqBytes, err := ioutil.ReadAll(req.Body)
+// encodeResponse encodes res as JSON, converts it using codec, and compresses
+// it if enabled and accepted by req, in which case the Content-Encoding is set
+// in header.
+func (h *handler) encodeResponse(header http.Header, req *http.Request,
+	codec Codec, res interface{}) ([]byte, error) {
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Preserve the exact "id" of each Request.
+	if err := enc.Encode(res); err != nil {
+		return nil, err
+	}
+	data, err := codec.FromJSON(buf.Bytes())
 	if err != nil {
-		return Response{Error: errorInternal(err.Error())}
+		return nil, err
+	}
+
+	if h.compression == nil || len(data) < h.compression.MinBytes {
+		return data, nil
+	}
+	encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return data, nil
+	}
+	data, err = h.compression.compress(encoding, data)
+	if err != nil {
+		return nil, err
+	}
+	header.Set("Content-Encoding", encoding)
+	return data, nil
+}
+
+// handle an http.Request with a body encoded using codec. If status is not
+// zero, it should be used as the HTTP status code of the http.Response
+// regardless of the StatusPolicy.
+func (h *handler) handle(req *http.Request,
+	codec Codec) (_ interface{}, status int) {
+
+	// fail reports an Error affecting the whole http.Request to
+	// h.metrics and h.access, and returns it as a Response with status.
+	start := time.Now()
+	fail := func(err Error, status int) (interface{}, int) {
+		res := Response{Error: err}
+		h.metrics.started("")
+		h.metrics.finished("", err, start)
+		h.access.add(req.Context(), start, req.RemoteAddr, "", nil, nil,
+			res)
+		return res, status
+	}
+
+	// Decompress the HTTP request body if compression is enabled.
+	body := io.Reader(req.Body)
+	if h.compression != nil {
+		var err error
+		body, err = decompressor(body, req.Header.Get("Content-Encoding"))
+		if errors.Is(err, errUnsupportedEncoding) {
+			return fail(errorParse(err.Error()),
+				http.StatusUnsupportedMediaType)
+		}
+		if err != nil {
+			return fail(errorParse(err.Error()), 0)
+		}
+	}
+
+	// Read all bytes of HTTP request body, up to any limit.
+	reqBytes, err := h.limits.readBody(body)
+	if err != nil {
+		var errLimit Error
+		if errors.As(err, &errLimit) {
+			return fail(errLimit,
+				http.StatusRequestEntityTooLarge)
+		}
+		var errDecompress decompressError
+		if errors.As(err, &errDecompress) {
+			return fail(errorParse(err.Error()), 0)
+		}
+		return fail(errorInternal(err.Error()), 0)
+	}
+
+	// Convert any other encoding to JSON.
+	reqBytes, err = codec.ToJSON(reqBytes)
+	if err != nil {
+		return fail(errorParse(err.Error()), 0)
 	}
 
 	// Ensure valid JSON so it can be assumed going forward.
 	if !json.Valid(reqBytes) {
-		return Response{Error: errorParse(nil)}
+		return fail(errorParse(nil), 0)
+	}
+
+	// Reject deeply nested JSON before any further unmarshaling.
+	if err := h.limits.checkDepth(reqBytes); err != nil {
+		return fail(*err, 0)
+	}
+
+	// Catch batch requests that are too long before unmarshaling them.
+	if n := batchLen(reqBytes); n > 0 {
+		if err := h.limits.checkBatchLen(n); err != nil {
+			return fail(*err, 0)
+		}
 	}
 
 	// Attempt to unmarshal into a slice to detect a batch request. Use
@@ -106,53 +283,125 @@ func handle(methods MethodMap, req *http.Request, lgr Logger) interface{} {
 
 	// Catch empty batch requests.
 	if len(rawReqs) == 0 {
-		return Response{Error: errorInvalidRequest("empty batch request")}
+		return fail(errorInvalidRequest("empty batch request"), 0)
+	}
+
+	if batch {
+		h.metrics.batch(len(rawReqs))
+	}
+
+	// Process each Request, propagating any trace context received.
+	ctx := extractTrace(req.Context(), req.Header)
+	ctx = context.WithValue(ctx, httpInfoKey{},
+		httpInfo{remoteAddr: req.RemoteAddr, batch: batch})
+	responses := h.process(ctx, rawReqs)
+
+	// Send nothing if the http.Request was canceled or there are no
+	// responses.
+	if req.Context().Err() != nil || len(responses) == 0 {
+		return nil, 0
+	}
+
+	// Return the BatchResponse if this was a batch request.
+	if batch {
+		return responses, 0
 	}
 
-	// Process each Request, omitting any returned Response that is empty.
+	// Return a single Response.
+	return responses[0], 0
+}
+
+// httpInfo describes the http.Request that Requests were received in.
+type httpInfo struct {
+	remoteAddr string
+
+	// batch is true for a batch request.
+	batch bool
+}
+
+// httpInfoKey is the context.Context key for an httpInfo.
+type httpInfoKey struct{}
+
+// httpInfoFromContext returns the httpInfo carried by ctx, if any.
+func httpInfoFromContext(ctx context.Context) httpInfo {
+	info, _ := ctx.Value(httpInfoKey{}).(httpInfo)
+	return info
+}
+
+// processRequests processes each Request in rawReqs in order, omitting any
+// returned Response that is empty. If ctx is done, any remaining Requests are
+// not processed.
+func (h *handler) processRequests(ctx context.Context,
+	rawReqs []json.RawMessage) BatchResponse {
+
+	batch := httpInfoFromContext(ctx).batch
 	responses := make(BatchResponse, 0, len(rawReqs))
-	for _, rawReq := range rawReqs {
-		if req.Context().Err() != nil {
+	for i, rawReq := range rawReqs {
+		if ctx.Err() != nil {
 			return nil
 		}
-		res := processRequest(req.Context(), methods, rawReq, lgr)
+		index := -1
+		if batch {
+			index = i
+		}
+		res := h.processRequest(ctx, rawReq, index)
 		if res == (Response{}) {
 			// Don't respond to Notifications.
 			continue
 		}
 		responses = append(responses, res)
 	}
+	return responses
+}
 
-	// Send nothing if there are no responses.
-	if len(responses) == 0 {
-		return nil
-	}
-
-	// Return the BatchResponse if this was a batch request.
-	if batch {
-		return responses
-	}
-
-	// Return a single Response.
-	return responses[0]
+// invalidRequestResponse returns the Response for req, which could not be
+// unmarshaled because of err. The Response uses the version of req, if it was
+// detected.
+//
+// At this point we know that this was valid JSON, so this is a not a
+// ParseError, but something about the Request object did not conform to spec,
+// so we return an invalidRequest Error.
+//
+// At this point we have no way to know if this was a Request or Notification,
+// so we must respond with "id" set to null.
+func invalidRequestResponse(req Request, err error) Response {
+	return Response{Error: errorInvalidRequest(err.Error()),
+		version1: req.version1}
 }
 
-// processRequest unmarshals and processes a single Request stored in rawReq
-// using the methods defined in methods. If res is zero valued, then the
-// Request was a Notification and should not be responded to.
-func processRequest(ctx context.Context,
-	methods MethodMap, rawReq json.RawMessage, lgr Logger) (res Response) {
+// processRequest unmarshals and processes a single Request stored in rawReq,
+// which is at index within a batch request, or -1 if it is not in a batch.
+// If res is zero valued, then the Request was a Notification and should not
+// be responded to.
+func (h *handler) processRequest(ctx context.Context,
+	rawReq json.RawMessage, index int) (res Response) {
 
 	// Unmarshal into req with an error on any unknown fields.
-	var req Request
-	if err := json.Unmarshal(rawReq, &req); err != nil {
-		// At this point we know that this was valid JSON, so this is a
-		// not a ParseError, but something about the Request object did
-		// not conform to spec, so we return an invalidRequest Error.
-		//
-		// At this point we have no way to know if this was a Request
-		// or Notification, so we must respond with "id" set to null.
-		return Response{Error: errorInvalidRequest(err.Error())}
+	req, err := h.unmarshalRequest(rawReq)
+
+	// Report the call to h.metrics, using an empty method name unless the
+	// method exists, to bound the number of distinct names.
+	var name string
+	if _, ok := h.methods[req.Method]; ok && err == nil {
+		name = req.Method
+	}
+	start := h.metrics.started(name)
+	ctx, span := h.tracer.start(ctx, name, SpanServer)
+	span.SetAttribute(AttributeMethod, req.Method)
+	if id, ok := req.ID.(json.RawMessage); ok && id != nil {
+		span.SetAttribute(AttributeRequestID, string(id))
+	}
+	if index >= 0 {
+		span.SetAttribute(AttributeBatchIndex, index)
+	}
+
+	if err != nil {
+		res = invalidRequestResponse(req, err)
+		h.metrics.finished(name, res.Error, start)
+		span.End(res.Error)
+		h.access.add(ctx, start, httpInfoFromContext(ctx).remoteAddr,
+			req.Method, nil, nil, res)
+		return res
 	}
 
 	// Use a type assertion to get req.ID and req.Params as
@@ -161,27 +410,79 @@ func processRequest(ctx context.Context,
 	id, params := req.ID.(json.RawMessage), req.Params.(json.RawMessage)
 
 	// Never respond to Notifications, even if an Error occurs. For
-	// Requests, always use the Request ID in the Response.
+	// Requests, always use the Request ID and version in the Response.
 	defer func() {
 		if id == nil {
 			res = Response{}
 			return
 		}
 		res.ID = id
+		res.version1 = req.version1
+	}()
+
+	// This is deferred after the above so that it runs first, before the
+	// Response to any Notification is discarded.
+	defer func() {
+		h.metrics.finished(name, resError(res), start)
+		span.End(resError(res))
+		logged := Response{}
+		if id != nil {
+			logged = res
+			logged.ID = id
+			logged.version1 = req.version1
+		}
+		h.access.add(ctx, start, httpInfoFromContext(ctx).remoteAddr,
+			req.Method, id, params, logged)
 	}()
 
 	// Look up the requested method and call it if found.
-	method, ok := methods[req.Method]
+	method, ok := h.methods[req.Method]
 	if !ok {
 		return Response{Error: errorMethodNotFound(req.Method)}
 	}
-	res = method.call(ctx, req.Method, params, lgr)
+	var panicked *PanicInfo
+	res = method.call(ctx, req.Method, params, callOptions{
+		log:        h.log,
+		errors:     h.errors,
+		middleware: h.middleware,
+		onPanic: func(value interface{}, stack []byte) {
+			h.metrics.panicked(req.Method)
+			panicked = &PanicInfo{Value: value, Stack: stack,
+				Method: req.Method, Params: params, ID: id}
+			if h.panics.handler != nil {
+				h.panics.handler(ctx, *panicked)
+			}
+		},
+	})
+	if panicked != nil && h.panics.data && DebugMethodFunc {
+		res.Error.Data = panicked.data()
+	}
 
-	// Log the method name if debugging is enabled and the method had an
-	// internal error.
+	// Log the call if debugging is enabled and the method had an internal
+	// error.
 	if DebugMethodFunc && res.HasError() && res.Error.Code == ErrorCodeInternal {
-		lgr.Printf("Method: %#v\n\n", req.Method)
+		info := httpInfoFromContext(ctx)
+		kvs := []interface{}{FieldMethod, req.Method, FieldID, id,
+			FieldDuration, time.Since(start),
+			FieldErrorCode, res.Error.Code,
+			FieldRemoteAddr, info.remoteAddr}
+		if index >= 0 {
+			kvs = append(kvs, FieldBatchIndex, index)
+		}
+		h.log.debug("method returned an Internal Error", kvs...)
 	}
 
 	return res
 }
+
+// unmarshalRequest unmarshals the valid JSON in rawReq into a Request using
+// the configuration of h. See Request.UnmarshalJSON.
+func (h *handler) unmarshalRequest(rawReq json.RawMessage) (Request, error) {
+	var req Request
+	err := req.unmarshalJSON(rawReq, decodeOptions{
+		ids:      h.idPolicy,
+		policy:   h.decode,
+		version1: h.version1,
+	})
+	return req, err
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ID is a JSON-RPC 2.0 Request ID that preserves the exact JSON
+// representation of a String, Number or Null ID.
+//
+// ID is comparable, so it may be used with == and as a map key to correlate
+// Responses with Requests. Two IDs are equal only if their JSON
+// representations are identical, so the Number IDs 1 and 1.0 are not equal,
+// just as the Spec requires a Response ID to be the same as the Request ID.
+//
+// The zero value represents a Null ID.
+//
+// Note that json.Marshal escapes HTML characters in a String ID embedded in
+// other values. Request.MarshalJSON and Response.MarshalJSON do not.
+//
+// An ID may be used as the Request.ID, and a *ID may be used as the
+// Response.ID to unmarshal the "id".
+type ID struct {
+	// raw is the compact JSON of the ID, or empty for Null.
+	raw string
+}
+
+// StringID returns an ID representing the JSON String s.
+func StringID(s string) ID {
+	raw, _ := marshalJSON(s) // A string cannot cause an error.
+	return ID{string(raw)}
+}
+
+// Int64ID returns an ID representing the JSON Number n.
+func Int64ID(n int64) ID {
+	return ID{strconv.FormatInt(n, 10)}
+}
+
+// NumberID returns an ID representing the JSON Number n exactly, which may
+// exceed the range or precision of int64 or float64. An error is returned if n
+// is not a valid JSON Number.
+func NumberID(n json.Number) (ID, error) {
+	if _, err := validateNumber([]byte(n)); err != nil {
+		return ID{}, fmt.Errorf(`invalid "id": %w`, err)
+	}
+	return ID{string(n)}, nil
+}
+
+// ParseID returns the ID represented by the JSON in data. An error is
+// returned if data is not a valid JSON String, Number or Null.
+//
+// Unlike Request IDs, Number IDs with a fractional part are allowed.
+func ParseID(data json.RawMessage) (ID, error) {
+	raw := bytes.TrimSpace(data)
+	if err := (IDPolicy{AllowFractional: true}).validateID(raw); err != nil {
+		return ID{}, err
+	}
+	if !json.Valid(raw) {
+		return ID{}, fmt.Errorf(`invalid "id": invalid JSON: %s`, raw)
+	}
+	if string(raw) == "null" {
+		return ID{}, nil
+	}
+	return ID{string(raw)}, nil
+}
+
+// IsNull returns true if id represents a JSON Null.
+func (id ID) IsNull() bool {
+	return id.raw == ""
+}
+
+// Str returns the value of id and true if id represents a JSON String.
+func (id ID) Str() (string, bool) {
+	if id.IsNull() || id.raw[0] != '"' {
+		return "", false
+	}
+	var s string
+	json.Unmarshal([]byte(id.raw), &s)
+	return s, true
+}
+
+// Number returns the exact value of id and true if id represents a JSON
+// Number.
+func (id ID) Number() (json.Number, bool) {
+	if id.IsNull() || id.raw[0] == '"' {
+		return "", false
+	}
+	return json.Number(id.raw), true
+}
+
+// Int64 returns the value of id and true if id represents a JSON Number that
+// is an integer within the range of int64, written without a fraction or
+// exponent.
+func (id ID) Int64() (int64, bool) {
+	num, ok := id.Number()
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(num), 10, 64)
+	return n, err == nil
+}
+
+// String returns the JSON representation of id.
+func (id ID) String() string {
+	if id.IsNull() {
+		return "null"
+	}
+	return id.raw
+}
+
+// MarshalJSON returns the exact JSON representation of id.
+func (id ID) MarshalJSON() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalJSON sets id to the ID represented by data. See ParseID.
+func (id *ID) UnmarshalJSON(data []byte) error {
+	var err error
+	*id, err = ParseID(data)
+	return err
+}
+
+// marshalJSON is like json.Marshal but does not escape HTML characters, so
+// that raw JSON, such as an "id", is preserved exactly.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
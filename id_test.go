@@ -0,0 +1,197 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseIDTests = []struct {
+	Data string
+	Raw  string
+	Err  string
+}{
+	{Data: `null`, Raw: `null`},
+	{Data: ` "a<b>&c" `, Raw: `"a<b>&c"`},
+	{Data: `"<"`, Raw: `"<"`},
+	{Data: `12345678901234567890123`, Raw: `12345678901234567890123`},
+	{Data: `1.50e1`, Raw: `1.50e1`},
+	{Data: `-0`, Raw: `-0`},
+	{Data: `01`, Err: `invalid "id": invalid number "01": leading zero`},
+	{Data: `{}`, Err: `invalid "id": not a number, string, or null: object`},
+	{Data: `"`, Err: `invalid "id": invalid JSON: "`},
+}
+
+func TestParseID(t *testing.T) {
+	for _, test := range parseIDTests {
+		id, err := ParseID(json.RawMessage(test.Data))
+		if test.Err != "" {
+			assert.EqualError(t, err, test.Err, test.Data)
+			continue
+		}
+		if !assert.NoError(t, err, test.Data) {
+			continue
+		}
+		data, err := id.MarshalJSON()
+		assert.NoError(t, err, test.Data)
+		assert.Equal(t, test.Raw, string(data), test.Data)
+		assert.Equal(t, test.Raw, id.String(), test.Data)
+
+		var unmarshaled ID
+		assert.NoError(t, json.Unmarshal([]byte(test.Data), &unmarshaled))
+		assert.Equal(t, id, unmarshaled, test.Data)
+	}
+}
+
+func TestIDValues(t *testing.T) {
+	assert := assert.New(t)
+
+	var null ID
+	assert.True(null.IsNull())
+	_, ok := null.Str()
+	assert.False(ok)
+	_, ok = null.Number()
+	assert.False(ok)
+	assert.Equal(null, mustParseID(`null`))
+
+	str := StringID("<1>")
+	assert.Equal(`"<1>"`, str.String())
+	s, ok := str.Str()
+	assert.True(ok)
+	assert.Equal("<1>", s)
+	_, ok = str.Int64()
+	assert.False(ok)
+	assert.False(str.IsNull())
+
+	n := Int64ID(-9223372036854775808)
+	assert.Equal(`-9223372036854775808`, n.String())
+	i, ok := n.Int64()
+	assert.True(ok)
+	assert.Equal(int64(-9223372036854775808), i)
+	_, ok = n.Str()
+	assert.False(ok)
+
+	big, err := NumberID("18446744073709551616")
+	assert.NoError(err)
+	num, ok := big.Number()
+	assert.True(ok)
+	assert.Equal(json.Number("18446744073709551616"), num)
+	_, ok = big.Int64()
+	assert.False(ok)
+
+	_, err = NumberID("1.")
+	assert.EqualError(err,
+		`invalid "id": invalid number "1.": missing fraction digits`)
+
+	// IDs are equal only if their JSON is identical.
+	ids := map[ID]int{Int64ID(1): 1, StringID("1"): 2, mustParseID(`1.0`): 3}
+	assert.Len(ids, 3)
+	assert.Equal(1, ids[mustParseID(` 1 `)])
+	assert.Equal(2, ids[mustParseID(`"1"`)])
+	assert.Equal(3, ids[mustParseID(`1.0`)])
+}
+
+func mustParseID(data string) ID {
+	id, err := ParseID(json.RawMessage(data))
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func TestIDRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	id := StringID("a<b>&c")
+	req := Request{Method: "echo", ID: id}
+	data, err := req.MarshalJSON()
+	assert.NoError(err)
+	assert.Equal(`{"jsonrpc":"2.0","method":"echo","id":"a<b>&c"}`, string(data))
+
+	var unmarshaled Request
+	assert.NoError(json.Unmarshal(data, &unmarshaled))
+	reqID, err := ParseID(unmarshaled.ID.(json.RawMessage))
+	assert.NoError(err)
+	assert.Equal(id, reqID)
+
+	handler := HTTPRequestHandler(MethodMap{
+		"echo": func(context.Context, json.RawMessage) interface{} {
+			return "ok"
+		},
+	}, nil)
+	for _, rawID := range []string{`"a<b>&c"`, `"\u003c"`,
+		`12345678901234567890123`, `1E+3`} {
+		body := `{"jsonrpc":"2.0","method":"echo","id":` + rawID + `}`
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(body)))
+		assert.Equal(`{"jsonrpc":"2.0","result":"ok","id":`+rawID+"}\n",
+			w.Body.String())
+
+		var resID ID
+		res := Response{ID: &resID}
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(mustParseID(rawID), resID)
+	}
+}
+
+func TestClientResponseID(t *testing.T) {
+	assert := assert.New(t)
+
+	var resID string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			var req struct{ ID json.RawMessage }
+			json.Unmarshal(body, &req)
+			id := resID
+			if id == "" {
+				id = string(req.ID)
+			}
+			w.Write([]byte(`{"jsonrpc":"2.0","result":"ok","id":` + id + `}`))
+		}))
+	defer srv.Close()
+
+	var c Client
+	var result string
+	assert.NoError(c.Request(nil, srv.URL, "method", nil, &result))
+	assert.Equal("ok", result)
+
+	resID = `"1"`
+	err := c.Request(nil, srv.URL, "method", nil, &result)
+	var errRes ErrorUnexpectedHTTPResponse
+	if assert.True(errors.As(err, &errRes)) {
+		assert.Contains(err.Error(), `"id" "1" does not match Request "id"`)
+	}
+
+	resID = `null`
+	err = c.Request(nil, srv.URL, "method", nil, &result)
+	assert.True(errors.As(err, &errRes))
+}
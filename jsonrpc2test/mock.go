@@ -0,0 +1,274 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package jsonrpc2test provides utilities for testing code that uses the
+// jsonrpc2 package, without any network.
+package jsonrpc2test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/AdamSLevy/jsonrpc2/v14"
+)
+
+// TestingT is the subset of *testing.T used to report failures.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Mock is a JSON-RPC 2.0 server that responds according to a list of
+// Expectations, and reports any unexpected or unmet calls through a
+// TestingT.
+//
+// Use Mock.Client to make requests to the Mock without any network, or use
+// the Mock as the http.Handler of an httptest.Server.
+type Mock struct {
+	t TestingT
+
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+// NewMock returns a Mock that reports failures to t.
+func NewMock(t TestingT) *Mock {
+	return &Mock{t: t}
+}
+
+// Expectation describes the calls expected for a method by a Mock, and how to
+// respond to them. Use the methods of Expectation to configure it.
+type Expectation struct {
+	method string
+	params func(json.RawMessage) bool
+	desc   string
+
+	result interface{}
+	err    *jsonrpc2.Error
+
+	times int
+	calls int
+}
+
+// Expect adds and returns an Expectation for a single call of method with
+// any params that returns a null result.
+func (m *Mock) Expect(method string) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := &Expectation{method: method, times: 1, desc: "any params"}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// WithParams restricts e to calls whose params are equal to params when
+// marshaled to JSON. Whitespace and the order of object members are ignored.
+func (e *Expectation) WithParams(params interface{}) *Expectation {
+	want, err := canonical(params)
+	if err != nil {
+		panic(fmt.Errorf("jsonrpc2test: WithParams: %w", err))
+	}
+	e.WithParamsFunc(func(params json.RawMessage) bool {
+		got, err := canonical(params)
+		return err == nil && bytes.Equal(want, got)
+	})
+	e.desc = fmt.Sprintf("params %v", string(want))
+	return e
+}
+
+// WithParamsFunc restricts e to calls whose params cause match to return
+// true. The params are nil if they were omitted or null.
+func (e *Expectation) WithParamsFunc(
+	match func(params json.RawMessage) bool) *Expectation {
+	e.params = match
+	e.desc = "matching params"
+	return e
+}
+
+// Return sets the result returned for calls matching e.
+func (e *Expectation) Return(result interface{}) *Expectation {
+	e.result, e.err = result, nil
+	return e
+}
+
+// ReturnError sets the Error returned for calls matching e. The same
+// restrictions on the Error apply as for a jsonrpc2.MethodFunc.
+func (e *Expectation) ReturnError(err jsonrpc2.Error) *Expectation {
+	e.result, e.err = nil, &err
+	return e
+}
+
+// Times sets the number of calls expected to match e.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) String() string {
+	return fmt.Sprintf("%q with %v", e.method, e.desc)
+}
+
+// AssertExpectations reports any Expectation that has not been called the
+// expected number of times, and returns false if there are any.
+func (m *Mock) AssertExpectations() bool {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for _, e := range m.expectations {
+		if e.calls < e.times {
+			m.t.Errorf("jsonrpc2test: expected %v %v time(s), got %v",
+				e, e.times, e.calls)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// ServeHTTP handles JSON-RPC 2.0 requests like jsonrpc2.HTTPRequestHandler,
+// calling the Expectations instead of MethodFuncs.
+//
+// Calls to a method without any Expectation are reported as unexpected and
+// receive a Method not found Error. Calls that match no remaining Expectation
+// for their method are reported as unexpected and receive an Internal Error.
+func (m *Mock) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		m.t.Errorf("jsonrpc2test: reading request body: %v", err)
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Report calls to methods without any Expectation, since the handler
+	// never calls them.
+	methods := m.methods()
+	var rawReqs []json.RawMessage
+	if json.Unmarshal(body, &rawReqs) != nil {
+		rawReqs = []json.RawMessage{body}
+	}
+	for _, rawReq := range rawReqs {
+		var r jsonrpc2.Request
+		if json.Unmarshal(rawReq, &r) != nil {
+			continue
+		}
+		if _, ok := methods[r.Method]; !ok {
+			m.t.Errorf("jsonrpc2test: unexpected call of %q with params %v",
+				r.Method, paramsString(r.Params.(json.RawMessage)))
+		}
+	}
+
+	jsonrpc2.HTTPRequestHandler(methods, log.New(ioutil.Discard, "", 0)).
+		ServeHTTP(w, req)
+}
+
+// Client returns a Client that sends all requests to m without any network,
+// regardless of the URL used.
+func (m *Mock) Client() *jsonrpc2.Client {
+	var c jsonrpc2.Client
+	c.Transport = m.RoundTripper()
+	return &c
+}
+
+// RoundTripper returns an http.RoundTripper that serves all http.Requests
+// using m without any network.
+func (m *Mock) RoundTripper() http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		res := w.Result()
+		res.Request = req
+		return res, nil
+	})
+}
+
+// methods returns a MethodMap with a MethodFunc for each method with an
+// Expectation.
+func (m *Mock) methods() jsonrpc2.MethodMap {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods := make(jsonrpc2.MethodMap, len(m.expectations))
+	for _, e := range m.expectations {
+		method := e.method
+		methods[method] = func(_ context.Context,
+			params json.RawMessage) interface{} {
+			return m.call(method, params)
+		}
+	}
+	return methods
+}
+
+// call returns the response of the first Expectation for method matching
+// params that has remaining calls.
+func (m *Mock) call(method string, params json.RawMessage) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expectations {
+		if e.method != method || e.calls >= e.times ||
+			e.params != nil && !e.params(params) {
+			continue
+		}
+		e.calls++
+		if e.err != nil {
+			return *e.err
+		}
+		return e.result
+	}
+	m.t.Errorf("jsonrpc2test: unexpected call of %q with params %v",
+		method, paramsString(params))
+	// Panic so that the handler returns an Internal Error.
+	panic("jsonrpc2test: unexpected call")
+}
+
+// canonical returns the JSON encoding of v with insignificant whitespace
+// removed and object members sorted.
+func canonical(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// paramsString returns params as a string for failure messages.
+func paramsString(params json.RawMessage) string {
+	if params == nil {
+		return "null"
+	}
+	return string(params)
+}
+
+// roundTripperFunc allows a func to be used as an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdamSLevy/jsonrpc2/v14"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMock(t *testing.T) {
+	assert := assert.New(t)
+
+	var rt recordingT
+	m := NewMock(&rt)
+	m.Expect("add").WithParams([]int{1, 2}).Return(3).Times(2)
+	m.Expect("add").WithParams(map[string]int{"b": 2, "a": 1}).Return(3)
+	m.Expect("fail").ReturnError(jsonrpc2.NewError(1, "fail", "data"))
+	m.Expect("any").WithParamsFunc(func(params json.RawMessage) bool {
+		return params == nil
+	})
+	m.Expect("unmet")
+
+	c := m.Client()
+	var n int
+	assert.NoError(c.Request(nil, "http://mock", "add", []int{1, 2}, &n))
+	assert.Equal(3, n)
+	assert.NoError(c.Request(nil, "http://mock", "add", []int{1, 2}, &n))
+	assert.NoError(c.Request(nil, "http://mock", "add",
+		json.RawMessage(`{ "a": 1, "b": 2 }`), &n))
+	assert.Equal(jsonrpc2.Error{Code: 1, Message: "fail", Data: "data"},
+		c.Request(nil, "http://mock", "fail", nil, nil))
+	assert.NoError(c.Notify(nil, "http://mock", "any", nil))
+	assert.Empty(rt.errors)
+
+	// Unexpected calls.
+	err := c.Request(nil, "http://mock", "add", []int{1, 2}, &n)
+	if assert.IsType(jsonrpc2.Error{}, err) {
+		assert.Equal(jsonrpc2.ErrorCodeInternal, err.(jsonrpc2.Error).Code)
+	}
+	err = c.Request(nil, "http://mock", "other", nil, nil)
+	if assert.IsType(jsonrpc2.Error{}, err) {
+		assert.Equal(jsonrpc2.ErrorCodeMethodNotFound,
+			err.(jsonrpc2.Error).Code)
+	}
+	assert.Equal([]string{
+		`jsonrpc2test: unexpected call of "add" with params [1,2]`,
+		`jsonrpc2test: unexpected call of "other" with params null`,
+	}, rt.errors)
+
+	// Unmet expectations.
+	rt.errors = nil
+	assert.False(m.AssertExpectations())
+	assert.Equal([]string{
+		`jsonrpc2test: expected "unmet" with any params 1 time(s), got 0`,
+	}, rt.errors)
+
+	// The Mock may also be used with an httptest.Server.
+	m = NewMock(t)
+	m.Expect("ping").Return("pong")
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	var pong string
+	assert.NoError(new(jsonrpc2.Client).Request(nil, srv.URL, "ping", nil, &pong))
+	assert.Equal("pong", pong)
+	assert.True(m.AssertExpectations())
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Limits bounds the resources that the HTTPRequestHandler will spend on a
+// single http.Request. A zero value for any field means there is no limit.
+//
+// Use WithLimits to set the Limits for the HTTPRequestHandler.
+type Limits struct {
+	// MaxBodyBytes is the maximum number of bytes read from the
+	// http.Request.Body. Larger bodies are not processed and an Invalid
+	// Request Error is returned with the HTTP status code 413 Request
+	// Entity Too Large.
+	MaxBodyBytes int64
+
+	// MaxBatchLen is the maximum number of Requests allowed in a batch
+	// request. Longer batches are not processed and a single Invalid
+	// Request Error is returned.
+	MaxBatchLen int
+
+	// MaxDepth is the maximum nesting depth of JSON arrays and objects in
+	// the http.Request.Body. The array of a batch request and the object
+	// of each Request each count as one level. Deeper JSON is not
+	// processed and an Invalid Request Error is returned.
+	MaxDepth int
+}
+
+// WithLimits returns a HandlerOption that sets the Limits used by the
+// HTTPRequestHandler.
+func WithLimits(l Limits) HandlerOption {
+	return func(h *handler) {
+		h.limits = l
+	}
+}
+
+// readBody reads all bytes from r. If l.MaxBodyBytes is exceeded, an Invalid
+// Request Error is returned.
+func (l Limits) readBody(r io.Reader) ([]byte, error) {
+	if l.MaxBodyBytes <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	// Read one additional byte to detect if the limit was exceeded.
+	data, err := ioutil.ReadAll(io.LimitReader(r, l.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > l.MaxBodyBytes {
+		return nil, errorInvalidRequest(fmt.Sprintf(
+			"request body exceeds limit of %v bytes", l.MaxBodyBytes))
+	}
+	return data, nil
+}
+
+// checkBatchLen returns an Invalid Request Error if n exceeds l.MaxBatchLen.
+func (l Limits) checkBatchLen(n int) *Error {
+	if l.MaxBatchLen <= 0 || n <= l.MaxBatchLen {
+		return nil
+	}
+	err := errorInvalidRequest(fmt.Sprintf(
+		"batch length %v exceeds limit of %v", n, l.MaxBatchLen))
+	return &err
+}
+
+// checkDepth assumes that data is valid JSON and returns an Invalid Request
+// Error if the nesting depth of arrays and objects exceeds l.MaxDepth.
+func (l Limits) checkDepth(data []byte) *Error {
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	if depth(data) <= l.MaxDepth {
+		return nil
+	}
+	err := errorInvalidRequest(fmt.Sprintf(
+		"nesting depth exceeds limit of %v", l.MaxDepth))
+	return &err
+}
+
+// depth assumes that data is valid JSON and returns the maximum nesting depth
+// of arrays and objects. Brackets within strings are ignored.
+func depth(data []byte) int {
+	var cur, max int
+	var inString, escaped bool
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '[', '{':
+			cur++
+			if cur > max {
+				max = cur
+			}
+		case ']', '}':
+			cur--
+		}
+	}
+	return max
+}
+
+// batchLen assumes that data is valid JSON and returns the number of elements
+// in it, if it is an array, without unmarshaling it, or -1 otherwise. Commas
+// within strings or nested values are ignored.
+func batchLen(data []byte) int {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return -1
+	}
+	if len(bytes.TrimSpace(data[1:len(data)-1])) == 0 {
+		return 0
+	}
+	n := 1
+	var cur int
+	var inString, escaped bool
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '[', '{':
+			cur++
+		case ']', '}':
+			cur--
+		case ',':
+			if cur == 1 {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var limitsTests = []struct {
+	Name   string
+	Limits Limits
+	Body   string
+	Status int
+	Data   string
+}{{
+	Name:   "no limits",
+	Body:   `[{"jsonrpc":"2.0","method":"echo","params":[[[1]]],"id":1}]`,
+	Status: http.StatusOK,
+}, {
+	Name:   "body within limit",
+	Limits: Limits{MaxBodyBytes: 48},
+	Body:   `{"jsonrpc":"2.0","method":"echo","id":1}`,
+	Status: http.StatusOK,
+}, {
+	Name:   "body too large",
+	Limits: Limits{MaxBodyBytes: 10},
+	Body:   `{"jsonrpc":"2.0","method":"echo","id":1}`,
+	Status: http.StatusRequestEntityTooLarge,
+	Data:   "request body exceeds limit of 10 bytes",
+}, {
+	Name:   "batch within limit",
+	Limits: Limits{MaxBatchLen: 2},
+	Body: `[{"jsonrpc":"2.0","method":"echo","id":1},
+		{"jsonrpc":"2.0","method":"echo","id":2}]`,
+	Status: http.StatusOK,
+}, {
+	Name:   "batch too long",
+	Limits: Limits{MaxBatchLen: 1},
+	Body: `[{"jsonrpc":"2.0","method":"echo","id":1},
+		{"jsonrpc":"2.0","method":"echo","id":2}]`,
+	Status: http.StatusOK,
+	Data:   "batch length 2 exceeds limit of 1",
+}, {
+	Name:   "depth within limit",
+	Limits: Limits{MaxDepth: 3},
+	Body:   `{"jsonrpc":"2.0","method":"echo","params":[["[[["]],"id":1}`,
+	Status: http.StatusOK,
+}, {
+	Name:   "depth too deep",
+	Limits: Limits{MaxDepth: 3},
+	Body:   `[{"jsonrpc":"2.0","method":"echo","params":[[1]],"id":1}]`,
+	Status: http.StatusOK,
+	Data:   "nesting depth exceeds limit of 3",
+}}
+
+func TestLimits(t *testing.T) {
+	methods := MethodMap{"echo": func(_ context.Context,
+		params json.RawMessage) interface{} {
+		return params
+	}}
+	for _, test := range limitsTests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			h := HTTPRequestHandler(methods, nil, WithLimits(test.Limits))
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodPost, "/",
+				strings.NewReader(test.Body)))
+			assert.Equal(test.Status, w.Code)
+
+			var res Response
+			if test.Data == "" {
+				// Any successful response is either a Response
+				// or BatchResponse without any Error.
+				assert.NotContains(w.Body.String(), `"error"`)
+				return
+			}
+			if assert.NoError(json.Unmarshal(w.Body.Bytes(), &res)) {
+				assert.Equal(errorInvalidRequest(test.Data), res.Error)
+			}
+		})
+	}
+}
+
+func TestDepth(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0, depth([]byte(`"[{"`)))
+	assert.Equal(1, depth([]byte(`{"a":"\"]}"}`)))
+	assert.Equal(3, depth([]byte(`[{"a":[]},[]]`)))
+}
+
+func TestBatchLen(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(-1, batchLen([]byte(`{"a":[1,2]}`)))
+	assert.Equal(-1, batchLen([]byte(`"[1,2]"`)))
+	assert.Equal(0, batchLen([]byte(` [ ] `)))
+	assert.Equal(1, batchLen([]byte(`[{"a":[1,2],"b":"\",]"}]`)))
+	assert.Equal(3, batchLen([]byte(`[1, [2, 3], {"a":4,"b":5}]`)))
+}
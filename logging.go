@@ -0,0 +1,235 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// EventLogger receives structured log Events from the HTTPRequestHandler,
+// Client and the other types of this package. Implementations must be safe
+// for concurrent use.
+//
+// Use WithEventLogger to set the EventLogger for the HTTPRequestHandler, or
+// set Client.EventLog. Use NewEventLogger to adapt a Logger, such as a
+// *log.Logger.
+type EventLogger interface {
+	LogEvent(Event)
+}
+
+// EventLoggerFunc allows a func to be used as an EventLogger.
+type EventLoggerFunc func(Event)
+
+// LogEvent calls f(e).
+func (f EventLoggerFunc) LogEvent(e Event) {
+	f(e)
+}
+
+// Level is the severity of an Event.
+type Level int
+
+const (
+	// LevelDebug is for Events only logged when debugging is enabled, for
+	// example by DebugMethodFunc or Client.DebugRequest.
+	LevelDebug Level = iota
+
+	// LevelError is for errors that cannot be returned to the caller.
+	LevelError
+)
+
+// String returns "debug" or "error".
+func (l Level) String() string {
+	if l == LevelError {
+		return "error"
+	}
+	return "debug"
+}
+
+// Event is a single structured log event.
+type Event struct {
+	Time    time.Time
+	Level   Level
+	Message string
+
+	// Fields hold the details of the Event in order. See FieldMethod for
+	// the common keys.
+	Fields []Field
+}
+
+// Field is a key/value pair of an Event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// The common keys of Event Fields.
+const (
+	// FieldMethod is the method name of the Request.
+	FieldMethod = "method"
+
+	// FieldID is the "id" of the Request, as a json.RawMessage or ID.
+	FieldID = "id"
+
+	// FieldDuration is the time.Duration of the call.
+	FieldDuration = "duration"
+
+	// FieldErrorCode is the ErrorCode of any Error.
+	FieldErrorCode = "error_code"
+
+	// FieldError is any error.
+	FieldError = "error"
+
+	// FieldRemoteAddr is the remote address of the http.Request.
+	FieldRemoteAddr = "remote_addr"
+
+	// FieldBatchIndex is the index of the Request within a batch request.
+	FieldBatchIndex = "batch_index"
+
+	// FieldURL is the URL of an endpoint or backend.
+	FieldURL = "url"
+
+	// FieldBody is the string of the raw body sent or received.
+	FieldBody = "body"
+
+	// FieldParams is the "params" of the Request, as a json.RawMessage.
+	FieldParams = "params"
+
+	// FieldResult is the result returned by the MethodFunc, formatted
+	// as a string.
+	FieldResult = "result"
+
+	// FieldStack is the stack trace of a panic, as a []byte.
+	FieldStack = "stack"
+)
+
+// Value returns the value of the first Field with key, or nil if there is
+// none.
+func (e Event) Value(key string) interface{} {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// String returns e formatted as a single line of text, without the Time or
+// Level, like:
+//
+//	jsonrpc2: message key=value key="quoted value"
+//
+// Empty values and values containing whitespace are quoted, and multiline
+// values, such as stack traces, follow on subsequent lines.
+func (e Event) String() string {
+	var b strings.Builder
+	b.WriteString("jsonrpc2: ")
+	b.WriteString(e.Message)
+	var multiline []Field
+	for _, f := range e.Fields {
+		v := formatFieldValue(f.Value)
+		if strings.Contains(v, "\n") {
+			multiline = append(multiline, f)
+			continue
+		}
+		b.WriteString(" ")
+		b.WriteString(f.Key)
+		b.WriteString("=")
+		if v == "" || strings.ContainsAny(v, " \t") {
+			v = fmt.Sprintf("%q", v)
+		}
+		b.WriteString(v)
+	}
+	for _, f := range multiline {
+		b.WriteString("\n")
+		b.WriteString(f.Key)
+		b.WriteString(":\n")
+		b.WriteString(strings.TrimRight(formatFieldValue(f.Value), "\n"))
+	}
+	return b.String()
+}
+
+// formatFieldValue formats v for Event.String.
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case json.RawMessage:
+		return string(v)
+	case []byte:
+		return string(v)
+	case ErrorCode:
+		return fmt.Sprint(int(v))
+	}
+	return fmt.Sprint(v)
+}
+
+// NewEventLogger returns an EventLogger that prints each Event using lgr, for
+// example a *log.Logger, in the format of Event.String. If lgr is nil, the
+// default Logger from the log package is used.
+func NewEventLogger(lgr Logger) EventLogger {
+	if lgr == nil {
+		lgr = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return EventLoggerFunc(func(e Event) {
+		lgr.Println(e)
+	})
+}
+
+// WithEventLogger returns a HandlerOption that logs Events to l instead of
+// the Logger passed to HTTPRequestHandler.
+func WithEventLogger(l EventLogger) HandlerOption {
+	return func(h *handler) {
+		h.log = eventLog{l}
+	}
+}
+
+// eventLog logs Events to an EventLogger.
+type eventLog struct {
+	l EventLogger
+}
+
+// newEventLog returns an eventLog using NewEventLogger(lgr).
+func newEventLog(lgr Logger) eventLog {
+	return eventLog{NewEventLogger(lgr)}
+}
+
+// log logs an Event with msg and the alternating keys and values in kvs.
+func (l eventLog) log(level Level, msg string, kvs ...interface{}) {
+	e := Event{Time: time.Now(), Level: level, Message: msg,
+		Fields: make([]Field, 0, len(kvs)/2)}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		e.Fields = append(e.Fields, Field{kvs[i].(string), kvs[i+1]})
+	}
+	l.l.LogEvent(e)
+}
+
+// debug logs an Event at LevelDebug.
+func (l eventLog) debug(msg string, kvs ...interface{}) {
+	l.log(LevelDebug, msg, kvs...)
+}
+
+// error logs an Event at LevelError.
+func (l eventLog) error(msg string, kvs ...interface{}) {
+	l.log(LevelError, msg, kvs...)
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventString(t *testing.T) {
+	e := Event{Message: "message", Fields: []Field{
+		{FieldMethod, "a b"},
+		{FieldID, json.RawMessage(`1`)},
+		{FieldErrorCode, ErrorCodeInternal},
+		{FieldError, errors.New("an error")},
+		{FieldURL, ""},
+		{FieldStack, []byte("line 1\nline 2\n")},
+		{FieldDuration, time.Second},
+	}}
+	assert.Equal(t, `jsonrpc2: message method="a b" id=1 error_code=-32603 `+
+		`error="an error" url="" duration=1s`+"\nstack:\nline 1\nline 2",
+		e.String())
+	assert.Equal(t, time.Second, e.Value(FieldDuration))
+	assert.Nil(t, e.Value(FieldBatchIndex))
+}
+
+func TestNewEventLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewEventLogger(log.New(&buf, "", 0))
+	l.LogEvent(Event{Message: "message", Fields: []Field{{"k", "v"}}})
+	assert.Equal(t, "jsonrpc2: message k=v\n", buf.String())
+}
+
+// eventRecorder records all Events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) LogEvent(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestWithEventLogger(t *testing.T) {
+	assert := assert.New(t)
+	DebugMethodFunc = true
+	defer func() { DebugMethodFunc = false }()
+
+	var rec eventRecorder
+	h := HTTPRequestHandler(metricsTestMethods, nil, WithEventLogger(&rec))
+	req := httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`[{"jsonrpc":"2.0","method":"ok","id":1},
+			{"jsonrpc":"2.0","method":"panic","params":[1],"id":2}]`))
+	h(httptest.NewRecorder(), req)
+
+	if !assert.Len(rec.events, 2) {
+		return
+	}
+	panicked := rec.events[0]
+	assert.Equal(LevelDebug, panicked.Level)
+	assert.Equal("panic running method", panicked.Message)
+	assert.Equal("panic", panicked.Value(FieldMethod))
+	assert.Equal("panic", panicked.Value(FieldError))
+	assert.Equal(json.RawMessage(`[1]`), panicked.Value(FieldParams))
+	assert.NotEmpty(panicked.Value(FieldStack))
+
+	internal := rec.events[1]
+	assert.Equal(LevelDebug, internal.Level)
+	assert.Equal("panic", internal.Value(FieldMethod))
+	assert.Equal(json.RawMessage(`2`), internal.Value(FieldID))
+	assert.Equal(ErrorCodeInternal, internal.Value(FieldErrorCode))
+	assert.Equal(req.RemoteAddr, internal.Value(FieldRemoteAddr))
+	assert.Equal(1, internal.Value(FieldBatchIndex))
+	assert.IsType(time.Duration(0), internal.Value(FieldDuration))
+}
+
+func TestClientEventLog(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(HTTPRequestHandler(metricsTestMethods, nil))
+	defer srv.Close()
+
+	var rec eventRecorder
+	c := Client{DebugRequest: true, EventLog: &rec}
+	assert.NoError(c.Request(context.Background(), srv.URL, "ok", nil, nil))
+
+	if !assert.Len(rec.events, 2) {
+		return
+	}
+	sent, received := rec.events[0], rec.events[1]
+	assert.Equal("sending request", sent.Message)
+	assert.Equal("ok", sent.Value(FieldMethod))
+	assert.NotNil(sent.Value(FieldID))
+	assert.Contains(sent.Value(FieldBody), `"method":"ok"`)
+	assert.Equal("received response", received.Message)
+	assert.Equal(srv.URL, received.Value(FieldURL))
+	assert.Contains(received.Value(FieldBody), `"result":"ok"`)
+
+	// Without an EventLog, events are printed using Log.
+	var buf bytes.Buffer
+	c = Client{DebugRequest: true, Log: log.New(&buf, "", 0)}
+	assert.NoError(c.Notify(context.Background(), srv.URL, "ok", nil))
+	assert.Equal(`jsonrpc2: sending request method=ok `+
+		`body={"jsonrpc":"2.0","method":"ok"}`+"\n"+
+		"jsonrpc2: received response url="+srv.URL+` body=""`+"\n",
+		buf.String())
+}
@@ -28,8 +28,8 @@ import (
 	"runtime"
 )
 
-// DebugMethodFunc controls whether additional debug information is printed to
-// stdout in the event of an InternalError when a MethodFunc is called.
+// DebugMethodFunc controls whether additional debug information is logged in
+// the event of an InternalError when a MethodFunc is called.
 //
 // This can be helpful when troubleshooting panics or Internal Errors from a
 // MethodFunc.
@@ -70,53 +70,94 @@ type MethodMap map[string]MethodFunc
 // To return an Error Response to the client, a MethodFunc must return a valid
 // Error. A valid Error must use ErrorCodeInvalidParams or any ErrorCode
 // outside of the reserved range, and the Error.Data must not cause an error
-// when passed to json.Marshal. If the Error is not valid, a panic will occur
-// and an Internal Error will be returned to the client.
+// when passed to json.Marshal. Only a Middleware, and not the MethodFunc
+// itself, may also return a ServerError. If the Error is not valid, a panic
+// will occur and an Internal Error will be returned to the client.
 //
 // If a MethodFunc panics or returns any other error, an Internal Error is
 // returned to the client. If the returned error is anything other than
-// context.Canceled or context.DeadlineExceeded, a panic will occur.
+// context.Canceled or context.DeadlineExceeded, a panic will occur, unless
+// errors are mapped to Errors using WithErrorMapper.
 //
 // For additional debug output from a MethodFunc regarding the cause of an
 // Internal Error, set DebugMethodFunc to true. Information about the method
-// call and a stack trace will be printed on panics.
+// call and a stack trace will be logged on panics. To report panics, for
+// example to an error tracker, use WithPanicHandler.
 type MethodFunc func(ctx context.Context, params json.RawMessage) interface{}
 
+// callOptions configure MethodFunc.call.
+type callOptions struct {
+	log eventLog
+
+	// onPanic, if not nil, is called with the value recovered from any
+	// panic and the stack trace.
+	onPanic func(value interface{}, stack []byte)
+
+	// errors, if not nil, maps any error returned that is not an Error.
+	errors ErrorMapper
+
+	// middleware wraps the method, and is the only source of ServerErrors.
+	middleware []Middleware
+}
+
 // call is used to safely call a method from within an http.HandlerFunc. call
 // wraps the actual invocation of the method so that it can recover from panics
 // and validate and sanitize the returned Response. If the method panics or
 // returns an invalid Response, an Internal Error is returned.
-func (method MethodFunc) call(ctx context.Context,
-	name string, params json.RawMessage, lgr Logger) (res Response) {
+func (method MethodFunc) call(ctx context.Context, name string,
+	params json.RawMessage, o callOptions) (res Response) {
 
 	var result interface{}
 	defer func() {
 		if err := recover(); err != nil {
 			res.Error = errorInternal(nil)
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			if o.onPanic != nil {
+				o.onPanic(err, buf)
+			}
 			if DebugMethodFunc {
-				//res.Data = err
-				const size = 64 << 10
-				buf := make([]byte, size)
-				buf = buf[:runtime.Stack(buf, false)]
-				lgr.Printf("jsonrpc2: panic running method %q: %v\n",
-					name, err)
-				lgr.Printf("jsonrpc2: Params: %v\n", string(params))
-				lgr.Printf("jsonrpc2: Return: %#v\n", result)
-				lgr.Println(string(buf))
+				o.log.debug("panic running method",
+					FieldMethod, name,
+					FieldError, err,
+					FieldParams, params,
+					FieldResult, fmt.Sprintf("%#v", result),
+					FieldStack, buf)
 			}
 		}
 	}()
-	result = method(ctx, params)
+	result = method.wrap(o.middleware)(ctx, params)
 	if err, ok := result.(error); ok {
+		// Server error codes are only allowed from a ServerError
+		// returned by Middleware, or from the ErrorMapper, which are
+		// used deliberately.
 		var methodErr Error
-		if errors.As(err, &methodErr) {
+		var serverErr ServerError
+		server := errors.As(err, &serverErr)
+		ok := server
+		if server {
+			methodErr = Error(serverErr)
+		} else {
+			ok = errors.As(err, &methodErr)
+		}
+		if !ok {
+			methodErr, ok = o.errors.Map(err)
+			server = ok
+		}
+		if ok {
 			// InvalidParamsCode is the only reserved ErrorCode
-			// MethodFuncs are allowed to return.
+			// MethodFuncs are allowed to return, other than server
+			// error codes.
 			if methodErr.Code == ErrorCodeInvalidParams {
 				if methodErr.Message == "" {
 					// Ensure the correct message is used if none is supplied.
 					methodErr.Message = ErrorMessageInvalidParams
 				}
+			} else if server && methodErr.Code.IsServerError() {
+				if methodErr.Message == "" {
+					methodErr.Message = serverErrorMessage(methodErr.Code)
+				}
 			} else if methodErr.Code.IsReserved() {
 				panic(fmt.Errorf("invalid use of %v", methodErr.Code))
 			}
@@ -145,6 +186,16 @@ func (method MethodFunc) call(ctx context.Context,
 			return
 		}
 
+		// If errors are mapped, a safe default is used for any
+		// unmapped error, which is logged since it may reveal
+		// implementation details.
+		if o.errors != nil {
+			o.log.error("unmapped error returned by method",
+				FieldMethod, name, FieldError, err)
+			res.Error = errorInternal(nil)
+			return
+		}
+
 		// Otherwise, if a MethodFunc intends to return an error to the
 		// client it must use the Error type, so this is a program
 		// integrity error that should be reported as a panic.
@@ -87,11 +87,12 @@ func TestMethodFuncCall(t *testing.T) {
 	for _, test := range testMethods {
 		var buf bytes.Buffer
 		lgr := log.New(&buf, "", 0) // record output
-		res := test.Func.call(context.Background(), "test", nil, lgr)
+		res := test.Func.call(context.Background(), "test", nil,
+			callOptions{log: newEventLog(lgr)})
 		if test.Error == nil {
 			assert.Equal(errorInternal(nil), res.Error, test.Name)
 			assert.Contains(string(buf.Bytes()),
-				`jsonrpc2: panic running method "test"`, test.Name)
+				`jsonrpc2: panic running method method=test`, test.Name)
 		} else {
 			assert.Equal(*test.Error, res.Error, test.Name)
 		}
@@ -103,7 +104,8 @@ func TestMethodFuncCall(t *testing.T) {
 	}
 	var buf bytes.Buffer
 	lgr := log.New(&buf, "", 0) // record output
-	res := f.call(context.Background(), "", nil, lgr)
+	res := f.call(context.Background(), "", nil,
+		callOptions{log: newEventLog(lgr)})
 	if assert.NotNil(res.Error) {
 		assert.Equal(Error{
 			Code:    100,
@@ -116,7 +118,8 @@ func TestMethodFuncCall(t *testing.T) {
 	f = func(_ context.Context, _ json.RawMessage) interface{} {
 		return ErrorInvalidParams("data")
 	}
-	res = f.call(context.Background(), "", nil, lgr)
+	res = f.call(context.Background(), "", nil,
+		callOptions{log: newEventLog(lgr)})
 	if assert.NotNil(res.Error) {
 		e := ErrorInvalidParams(json.RawMessage(`"data"`))
 		assert.Equal(e, res.Error)
@@ -129,7 +132,8 @@ func TestMethodFuncCall(t *testing.T) {
 	f = func(_ context.Context, _ json.RawMessage) interface{} {
 		return NewError(ErrorCodeInvalidParams, "", "data")
 	}
-	res = f.call(context.Background(), "", nil, lgr)
+	res = f.call(context.Background(), "", nil,
+		callOptions{log: newEventLog(lgr)})
 	if assert.NotNil(res.Error) {
 		e := ErrorInvalidParams(json.RawMessage(`"data"`))
 		assert.Equal(e, res.Error)
@@ -141,7 +145,8 @@ func TestMethodFuncCall(t *testing.T) {
 	f = func(_ context.Context, _ json.RawMessage) interface{} {
 		return NewError(ErrorCodeInvalidParams, "a custom error message", "data")
 	}
-	res = f.call(context.Background(), "", nil, lgr)
+	res = f.call(context.Background(), "", nil,
+		callOptions{log: newEventLog(lgr)})
 	if assert.NotNil(res.Error) {
 		assert.Equal("a custom error message", res.Error.Message)
 	}
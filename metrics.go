@@ -0,0 +1,429 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives instrumentation events from the HTTPRequestHandler or
+// Client. Implementations must be safe for concurrent use.
+//
+// Use WithMetrics to set the Metrics for the HTTPRequestHandler, or set
+// Client.Metrics. See MetricsRegistry for an implementation.
+type Metrics interface {
+	// CallStarted is called when a call to method starts.
+	CallStarted(method string)
+
+	// CallFinished is called when a call to method that started d ago
+	// finishes. The err is nil on success, an Error if the Response had
+	// an Error, and otherwise any other error returned by the Client.
+	CallFinished(method string, err error, d time.Duration)
+
+	// Batch is called with the number of Requests in each batch request.
+	Batch(n int)
+
+	// Panic is called when the MethodFunc for method panics.
+	Panic(method string)
+}
+
+// WithMetrics returns a HandlerOption that reports calls to m.
+//
+// Each Request is reported as a call, including Notifications. To bound the
+// number of distinct method names, any Request for a method not in the
+// MethodMap, or that is invalid, is reported with an empty method name, as
+// are errors affecting the whole http.Request, such as a Parse error.
+//
+// The HTTPGatewayHandler and HTTPReplayHandler report only batch sizes and
+// errors affecting the whole http.Request.
+func WithMetrics(m Metrics) HandlerOption {
+	return func(h *handler) {
+		h.metrics = metricsHook{m}
+	}
+}
+
+// metricsHook calls any Metrics it holds, and otherwise does nothing.
+type metricsHook struct {
+	m Metrics
+}
+
+// started reports the start of a call to method, and returns the start time.
+func (h metricsHook) started(method string) time.Time {
+	if h.m != nil {
+		h.m.CallStarted(method)
+	}
+	return time.Now()
+}
+
+// finished reports the end of a call to method that started at start.
+func (h metricsHook) finished(method string, err error, start time.Time) {
+	if h.m != nil {
+		h.m.CallFinished(method, err, time.Since(start))
+	}
+}
+
+// batch reports a batch request of n Requests.
+func (h metricsHook) batch(n int) {
+	if h.m != nil {
+		h.m.Batch(n)
+	}
+}
+
+// panicked reports a panic in the MethodFunc for method.
+func (h metricsHook) panicked(method string) {
+	if h.m != nil {
+		h.m.Panic(method)
+	}
+}
+
+// resError returns res.Error if res.HasError(), and otherwise nil.
+func resError(res Response) error {
+	if res.HasError() {
+		return res.Error
+	}
+	return nil
+}
+
+// DefaultLatencyBuckets are the default upper bounds, in seconds, of the
+// latency histogram buckets of a MetricsRegistry.
+var DefaultLatencyBuckets = []float64{
+	.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultBatchSizeBuckets are the default upper bounds of the batch size
+// histogram buckets of a MetricsRegistry.
+var DefaultBatchSizeBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+
+// MetricsRegistry is a Metrics that aggregates per method call counts, error
+// counts by ErrorCode, latency histograms, in-flight gauges and panic counts,
+// along with a histogram of batch sizes.
+//
+// MetricsRegistry implements expvar.Var, so it may be published using
+// expvar.Publish, or see NewExpvarMetrics. It also implements http.Handler to
+// serve the metrics in the Prometheus text format. See PrometheusHandler to
+// serve multiple MetricsRegistries.
+//
+// Errors that are not an Error, such as network errors from the Client, are
+// counted with the code "other".
+type MetricsRegistry struct {
+	namespace string
+
+	// LatencyBuckets and BatchSizeBuckets are the upper bounds of the
+	// histogram buckets, in ascending order. They must not be modified
+	// after the MetricsRegistry is in use.
+	LatencyBuckets   []float64
+	BatchSizeBuckets []float64
+
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+	batches *histogram
+}
+
+// methodMetrics holds the metrics for a single method.
+type methodMetrics struct {
+	calls    uint64
+	inFlight int64
+	errors   map[string]uint64
+	panics   uint64
+	latency  *histogram
+}
+
+// histogram counts observations in buckets with upper bounds.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] is the number of values <= bounds[i]
+	count  uint64
+	sum    float64
+}
+
+// observe adds v to h.
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// NewMetricsRegistry returns a MetricsRegistry that uses namespace as the
+// prefix of the Prometheus metric names, such as "jsonrpc2_server", and the
+// default buckets.
+func NewMetricsRegistry(namespace string) *MetricsRegistry {
+	return &MetricsRegistry{
+		namespace:        namespace,
+		LatencyBuckets:   DefaultLatencyBuckets,
+		BatchSizeBuckets: DefaultBatchSizeBuckets,
+	}
+}
+
+// NewExpvarMetrics returns a new MetricsRegistry published with expvar under
+// name, which is also used as the Prometheus namespace. Like
+// expvar.Publish, this panics if name is already in use.
+func NewExpvarMetrics(name string) *MetricsRegistry {
+	r := NewMetricsRegistry(name)
+	expvar.Publish(name, r)
+	return r
+}
+
+// method returns the methodMetrics for name. r.mu must be held.
+func (r *MetricsRegistry) method(name string) *methodMetrics {
+	if r.methods == nil {
+		r.methods = make(map[string]*methodMetrics)
+	}
+	m, ok := r.methods[name]
+	if !ok {
+		m = &methodMetrics{
+			errors:  make(map[string]uint64),
+			latency: newHistogram(r.LatencyBuckets),
+		}
+		r.methods[name] = m
+	}
+	return m
+}
+
+// newHistogram returns an empty histogram with bounds.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// CallStarted implements Metrics.
+func (r *MetricsRegistry) CallStarted(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method(method).inFlight++
+}
+
+// CallFinished implements Metrics.
+func (r *MetricsRegistry) CallFinished(method string, err error,
+	d time.Duration) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.method(method)
+	m.inFlight--
+	m.calls++
+	if err != nil {
+		m.errors[errorCodeLabel(err)]++
+	}
+	m.latency.observe(d.Seconds())
+}
+
+// errorCodeLabel returns the ErrorCode of err as a string, or "other" if err
+// is not an Error.
+func errorCodeLabel(err error) string {
+	var e Error
+	if errors.As(err, &e) {
+		return strconv.Itoa(int(e.Code))
+	}
+	return "other"
+}
+
+// Batch implements Metrics.
+func (r *MetricsRegistry) Batch(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batches == nil {
+		r.batches = newHistogram(r.BatchSizeBuckets)
+	}
+	r.batches.observe(float64(n))
+}
+
+// Panic implements Metrics.
+func (r *MetricsRegistry) Panic(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method(method).panics++
+}
+
+// methodNames returns the sorted method names. r.mu must be held.
+func (r *MetricsRegistry) methodNames() []string {
+	names := make([]string, 0, len(r.methods))
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the metrics as a JSON object, which implements expvar.Var.
+func (r *MetricsRegistry) String() string {
+	type jHistogram struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}
+	toJSON := func(h *histogram) jHistogram {
+		j := jHistogram{Count: h.count, Sum: h.sum,
+			Buckets: make(map[string]uint64, len(h.bounds))}
+		for i, bound := range h.bounds {
+			j.Buckets[formatFloat(bound)] = h.counts[i]
+		}
+		return j
+	}
+	type jMethod struct {
+		Calls    uint64            `json:"calls"`
+		InFlight int64             `json:"in_flight"`
+		Errors   map[string]uint64 `json:"errors"`
+		Panics   uint64            `json:"panics"`
+		Latency  jHistogram        `json:"latency"`
+	}
+	var v struct {
+		Methods   map[string]jMethod `json:"methods"`
+		BatchSize *jHistogram        `json:"batch_size,omitempty"`
+	}
+
+	r.mu.Lock()
+	v.Methods = make(map[string]jMethod, len(r.methods))
+	for name, m := range r.methods {
+		errs := make(map[string]uint64, len(m.errors))
+		for code, n := range m.errors {
+			errs[code] = n
+		}
+		v.Methods[name] = jMethod{Calls: m.calls, InFlight: m.inFlight,
+			Errors: errs, Panics: m.panics, Latency: toJSON(m.latency)}
+	}
+	if r.batches != nil {
+		batches := toJSON(r.batches)
+		v.BatchSize = &batches
+	}
+	r.mu.Unlock()
+
+	data, _ := json.Marshal(v) // This cannot cause an error.
+	return string(data)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	r.writePrometheus(w)
+}
+
+// prometheusContentType is the Content-Type of the Prometheus text format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler returns an http.Handler that serves the metrics of all
+// registries in the Prometheus text format. Each MetricsRegistry should have
+// a unique namespace.
+func PrometheusHandler(registries ...*MetricsRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		for _, r := range registries {
+			r.writePrometheus(w)
+		}
+	})
+}
+
+// writePrometheus writes the metrics to w in the Prometheus text format.
+func (r *MetricsRegistry) writePrometheus(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ns := r.namespace
+	names := r.methodNames()
+
+	fmt.Fprintf(w, "# HELP %v_calls_total Total calls by method.\n", ns)
+	fmt.Fprintf(w, "# TYPE %v_calls_total counter\n", ns)
+	for _, name := range names {
+		fmt.Fprintf(w, "%v_calls_total{method=%v} %v\n",
+			ns, promLabel(name), r.methods[name].calls)
+	}
+
+	fmt.Fprintf(w, "# HELP %v_errors_total Total errors by method and code.\n", ns)
+	fmt.Fprintf(w, "# TYPE %v_errors_total counter\n", ns)
+	for _, name := range names {
+		m := r.methods[name]
+		codes := make([]string, 0, len(m.errors))
+		for code := range m.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "%v_errors_total{method=%v,code=%v} %v\n",
+				ns, promLabel(name), promLabel(code), m.errors[code])
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP %v_in_flight Calls in progress by method.\n", ns)
+	fmt.Fprintf(w, "# TYPE %v_in_flight gauge\n", ns)
+	for _, name := range names {
+		fmt.Fprintf(w, "%v_in_flight{method=%v} %v\n",
+			ns, promLabel(name), r.methods[name].inFlight)
+	}
+
+	fmt.Fprintf(w, "# HELP %v_panics_total Total panics by method.\n", ns)
+	fmt.Fprintf(w, "# TYPE %v_panics_total counter\n", ns)
+	for _, name := range names {
+		fmt.Fprintf(w, "%v_panics_total{method=%v} %v\n",
+			ns, promLabel(name), r.methods[name].panics)
+	}
+
+	metric := ns + "_call_duration_seconds"
+	fmt.Fprintf(w, "# HELP %v Call latency by method.\n", metric)
+	fmt.Fprintf(w, "# TYPE %v histogram\n", metric)
+	for _, name := range names {
+		writePromHistogram(w, metric, "method="+promLabel(name)+",",
+			r.methods[name].latency)
+	}
+
+	if r.batches != nil {
+		metric := ns + "_batch_size"
+		fmt.Fprintf(w, "# HELP %v Requests per batch request.\n", metric)
+		fmt.Fprintf(w, "# TYPE %v histogram\n", metric)
+		writePromHistogram(w, metric, "", r.batches)
+	}
+}
+
+// writePromHistogram writes the buckets, sum and count of h for metric with
+// the labels, which must be empty or end with a comma.
+func writePromHistogram(w io.Writer, metric, labels string, h *histogram) {
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%v_bucket{%vle=%q} %v\n",
+			metric, labels, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%v_bucket{%vle=\"+Inf\"} %v\n", metric, labels, h.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%v_sum%v %v\n", metric, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%v_count%v %v\n", metric, labels, h.count)
+}
+
+// promLabel returns v as a quoted Prometheus label value.
+func promLabel(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+	return `"` + v + `"`
+}
+
+// formatFloat formats f in the shortest representation.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
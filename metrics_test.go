@@ -0,0 +1,171 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metricsTestMethods succeed, return an Error, or panic.
+var metricsTestMethods = MethodMap{
+	"ok": func(context.Context, json.RawMessage) interface{} {
+		return "ok"
+	},
+	"fail": func(context.Context, json.RawMessage) interface{} {
+		return NewError(1, "fail", nil)
+	},
+	"panic": func(context.Context, json.RawMessage) interface{} {
+		panic("panic")
+	},
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	assert := assert.New(t)
+	r := NewMetricsRegistry("test")
+
+	r.CallStarted("ok")
+	r.CallFinished("ok", nil, 2*time.Millisecond)
+	r.CallStarted("fail")
+	r.CallFinished("fail", NewError(1, "fail", nil), time.Millisecond)
+	r.CallStarted("fail")
+	r.CallFinished("fail", errors.New("fail"), time.Millisecond)
+	r.CallStarted("fail")
+	r.Panic("fail")
+	r.Batch(3)
+
+	var v struct {
+		Methods map[string]struct {
+			Calls    uint64
+			InFlight int64 `json:"in_flight"`
+			Errors   map[string]uint64
+			Panics   uint64
+			Latency  struct {
+				Count   uint64
+				Buckets map[string]uint64
+			}
+		}
+		BatchSize struct{ Count uint64 } `json:"batch_size"`
+	}
+	if !assert.NoError(json.Unmarshal([]byte(r.String()), &v)) {
+		return
+	}
+	assert.Equal(uint64(1), v.Methods["ok"].Calls)
+	assert.Equal(uint64(0), v.Methods["ok"].Latency.Buckets["0.001"])
+	assert.Equal(uint64(1), v.Methods["ok"].Latency.Buckets["0.0025"])
+	assert.Equal(uint64(2), v.Methods["fail"].Calls)
+	assert.Equal(int64(1), v.Methods["fail"].InFlight)
+	assert.Equal(map[string]uint64{"1": 1, "other": 1},
+		v.Methods["fail"].Errors)
+	assert.Equal(uint64(1), v.Methods["fail"].Panics)
+	assert.Equal(uint64(2), v.Methods["fail"].Latency.Count)
+	assert.Equal(uint64(1), v.BatchSize.Count)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nil)
+	assert.Equal(prometheusContentType, w.Header().Get("Content-Type"))
+	prom := w.Body.String()
+	for _, line := range []string{
+		"# TYPE test_calls_total counter",
+		`test_calls_total{method="ok"} 1`,
+		`test_errors_total{method="fail",code="1"} 1`,
+		`test_errors_total{method="fail",code="other"} 1`,
+		`test_in_flight{method="fail"} 1`,
+		`test_panics_total{method="fail"} 1`,
+		`test_call_duration_seconds_bucket{method="ok",le="0.001"} 0`,
+		`test_call_duration_seconds_bucket{method="ok",le="+Inf"} 1`,
+		`test_call_duration_seconds_count{method="ok"} 1`,
+		`test_batch_size_bucket{le="5"} 1`,
+		`test_batch_size_count 1`,
+	} {
+		assert.Contains(prom, line+"\n")
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	assert := assert.New(t)
+	r := NewMetricsRegistry("test")
+	h := HTTPRequestHandler(metricsTestMethods, nil, WithMetrics(r),
+		WithLimits(Limits{MaxBatchLen: 5}))
+
+	serve := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			strings.NewReader(body))
+		h(httptest.NewRecorder(), req)
+	}
+	serve(`[{"jsonrpc":"2.0","method":"ok","id":1},
+		{"jsonrpc":"2.0","method":"fail"},
+		{"jsonrpc":"2.0","method":"panic","id":2},
+		{"jsonrpc":"2.0","method":"unknown","id":3},
+		{"jsonrpc":"2.0","id":4}]`)
+	serve(`{`)
+	serve(`[1,2,3,4,5,6]`)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Equal([]string{"", "fail", "ok", "panic"}, r.methodNames())
+	assert.Equal(uint64(1), r.methods["ok"].calls)
+	assert.Empty(r.methods["ok"].errors)
+	assert.Equal(uint64(1), r.methods["fail"].calls,
+		"Notification not counted")
+	assert.Equal(uint64(1), r.methods["fail"].errors["1"])
+	assert.Equal(uint64(1), r.methods["panic"].panics)
+	assert.Equal(uint64(1),
+		r.methods["panic"].errors["-32603"])
+	assert.Equal(uint64(4), r.methods[""].calls)
+	assert.Equal(uint64(1), r.methods[""].errors["-32601"])
+	assert.Equal(uint64(2), r.methods[""].errors["-32600"])
+	assert.Equal(uint64(1), r.methods[""].errors["-32700"])
+	for _, m := range r.methods {
+		assert.Equal(int64(0), m.inFlight)
+	}
+	assert.Equal(uint64(1), r.batches.count)
+	assert.Equal(float64(5), r.batches.sum)
+}
+
+func TestClientMetrics(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(HTTPRequestHandler(metricsTestMethods, nil))
+	defer srv.Close()
+
+	r := NewMetricsRegistry("test")
+	c := Client{Metrics: r}
+	var result string
+	assert.NoError(c.Request(nil, srv.URL, "ok", nil, &result))
+	assert.Error(c.Request(nil, srv.URL, "fail", nil, &result))
+	assert.NoError(c.Notify(nil, srv.URL, "ok", nil))
+	assert.Error(c.Request(nil, "http://127.0.0.1:0", "ok", nil,
+		&result))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Equal(uint64(3), r.methods["ok"].calls)
+	assert.Equal(map[string]uint64{"other": 1}, r.methods["ok"].errors)
+	assert.Equal(map[string]uint64{"1": 1}, r.methods["fail"].errors)
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Middleware wraps the MethodFunc of every method called by a handler, for
+// example to enforce timeouts, rate limits or authentication. See
+// WithMiddleware.
+//
+// Unlike a MethodFunc, a Middleware may return a ServerError, such as
+// ErrorTimeout, instead of calling next. A ServerError returned by next itself
+// still results in a panic, and an Internal Error, so that a plain MethodFunc
+// can never return a server error code.
+type Middleware func(next MethodFunc) MethodFunc
+
+// WithMiddleware returns a HandlerOption that wraps each MethodFunc with mw,
+// in order, so that the first Middleware is called first.
+func WithMiddleware(mw ...Middleware) HandlerOption {
+	return func(h *handler) {
+		h.middleware = append(h.middleware, mw...)
+	}
+}
+
+// wrap returns method wrapped by mw, such that a ServerError returned by
+// method results in a panic.
+func (method MethodFunc) wrap(mw []Middleware) MethodFunc {
+	next := MethodFunc(func(ctx context.Context,
+		params json.RawMessage) interface{} {
+		result := method(ctx, params)
+		var serverErr ServerError
+		if err, ok := result.(error); ok && errors.As(err, &serverErr) {
+			panic(fmt.Errorf("invalid use of %v outside of Middleware",
+				serverErr.Code))
+		}
+		return result
+	})
+	for i := len(mw) - 1; i >= 0; i-- {
+		next = mw[i](next)
+	}
+	return next
+}
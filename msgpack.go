@@ -0,0 +1,323 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MessagePackCodec is a Codec for MessagePack, with the media type
+// "application/msgpack". See https://msgpack.org.
+//
+// Binary data is converted to a base64 encoded JSON String. Extension types,
+// and map keys that are not strings, are not supported.
+var MessagePackCodec Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+// ContentType returns "application/msgpack".
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+// FromJSON converts the JSON in data to MessagePack.
+func (msgpackCodec) FromJSON(data []byte) ([]byte, error) {
+	b, err := fromJSON(msgpackWriter{}, data)
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return b, nil
+}
+
+// ToJSON converts the MessagePack in data to JSON.
+func (msgpackCodec) ToJSON(data []byte) ([]byte, error) {
+	r := msgpackReader{binaryReader{data: data}}
+	var b bytes.Buffer
+	if err := r.value(&b); err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("msgpack: %v bytes after top level value",
+			len(r.data))
+	}
+	return b.Bytes(), nil
+}
+
+// msgpackWriter writes the shortest MessagePack encoding of each value.
+type msgpackWriter struct{}
+
+func (msgpackWriter) writeNull(b *bytes.Buffer) {
+	b.WriteByte(0xc0)
+}
+
+func (msgpackWriter) writeBool(b *bytes.Buffer, v bool) {
+	if v {
+		b.WriteByte(0xc3)
+	} else {
+		b.WriteByte(0xc2)
+	}
+}
+
+func (w msgpackWriter) writeInt(b *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0:
+		w.writeUint(b, uint64(v))
+	case v >= -32:
+		b.WriteByte(byte(v)) // negative fixint
+	case v >= math.MinInt8:
+		b.Write([]byte{0xd0, byte(v)})
+	case v >= math.MinInt16:
+		writeBigEndian(b, 0xd1, uint64(v), 2)
+	case v >= math.MinInt32:
+		writeBigEndian(b, 0xd2, uint64(v), 4)
+	default:
+		writeBigEndian(b, 0xd3, uint64(v), 8)
+	}
+}
+
+func (msgpackWriter) writeUint(b *bytes.Buffer, v uint64) {
+	switch {
+	case v <= 0x7f:
+		b.WriteByte(byte(v)) // positive fixint
+	case v <= math.MaxUint8:
+		b.Write([]byte{0xcc, byte(v)})
+	case v <= math.MaxUint16:
+		writeBigEndian(b, 0xcd, v, 2)
+	case v <= math.MaxUint32:
+		writeBigEndian(b, 0xce, v, 4)
+	default:
+		writeBigEndian(b, 0xcf, v, 8)
+	}
+}
+
+func (msgpackWriter) writeFloat(b *bytes.Buffer, v float64) {
+	if f := float32(v); float64(f) == v {
+		writeBigEndian(b, 0xca, uint64(math.Float32bits(f)), 4)
+		return
+	}
+	writeBigEndian(b, 0xcb, math.Float64bits(v), 8)
+}
+
+func (msgpackWriter) writeString(b *bytes.Buffer, v string) {
+	n := uint64(len(v))
+	switch {
+	case n <= 31:
+		b.WriteByte(0xa0 | byte(n)) // fixstr
+	case n <= math.MaxUint8:
+		b.Write([]byte{0xd9, byte(n)})
+	case n <= math.MaxUint16:
+		writeBigEndian(b, 0xda, n, 2)
+	default:
+		writeBigEndian(b, 0xdb, n, 4)
+	}
+	b.WriteString(v)
+}
+
+func (msgpackWriter) writeArray(b *bytes.Buffer, n int) {
+	switch {
+	case n <= 15:
+		b.WriteByte(0x90 | byte(n)) // fixarray
+	case n <= math.MaxUint16:
+		writeBigEndian(b, 0xdc, uint64(n), 2)
+	default:
+		writeBigEndian(b, 0xdd, uint64(n), 4)
+	}
+}
+
+func (msgpackWriter) writeMap(b *bytes.Buffer, n int) {
+	switch {
+	case n <= 15:
+		b.WriteByte(0x80 | byte(n)) // fixmap
+	case n <= math.MaxUint16:
+		writeBigEndian(b, 0xde, uint64(n), 2)
+	default:
+		writeBigEndian(b, 0xdf, uint64(n), 4)
+	}
+}
+
+// writeBigEndian writes the byte c followed by the n least significant bytes
+// of v in big endian order.
+func writeBigEndian(b *bytes.Buffer, c byte, v uint64, n int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	b.WriteByte(c)
+	b.Write(buf[8-n:])
+}
+
+// msgpackReader converts MessagePack values to JSON.
+type msgpackReader struct {
+	binaryReader
+}
+
+// value converts the next MessagePack value to JSON and writes it to b.
+func (r *msgpackReader) value(b *bytes.Buffer) error {
+	c, err := r.uint(1)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c <= 0x7f: // positive fixint
+		b.WriteString(strconv.FormatUint(c, 10))
+		return nil
+	case c >= 0xe0: // negative fixint
+		b.WriteString(strconv.FormatInt(int64(int8(c)), 10))
+		return nil
+	case c&0xf0 == 0x80: // fixmap
+		return r.object(b, c&0x0f)
+	case c&0xf0 == 0x90: // fixarray
+		return r.array(b, c&0x0f)
+	case c&0xe0 == 0xa0: // fixstr
+		return r.string(b, c&0x1f)
+	}
+
+	switch c {
+	case 0xc0:
+		b.WriteString("null")
+	case 0xc2:
+		b.WriteString("false")
+	case 0xc3:
+		b.WriteString("true")
+	case 0xc4, 0xc5, 0xc6: // bin 8, 16, 32
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return err
+		}
+		data, err := r.next(n)
+		if err != nil {
+			return err
+		}
+		writeJSONBytes(b, data)
+	case 0xca: // float 32
+		bits, err := r.uint(4)
+		if err != nil {
+			return err
+		}
+		return writeJSONFloat(b,
+			float64(math.Float32frombits(uint32(bits))))
+	case 0xcb: // float 64
+		bits, err := r.uint(8)
+		if err != nil {
+			return err
+		}
+		return writeJSONFloat(b, math.Float64frombits(bits))
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8, 16, 32, 64
+		u, err := r.uint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatUint(u, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8, 16, 32, 64
+		n := 1 << (c - 0xd0)
+		u, err := r.uint(n)
+		if err != nil {
+			return err
+		}
+		// Sign extend the n byte integer.
+		shift := uint(64 - 8*n)
+		b.WriteString(strconv.FormatInt(int64(u<<shift)>>shift, 10))
+	case 0xd9, 0xda, 0xdb: // str 8, 16, 32
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return err
+		}
+		return r.string(b, n)
+	case 0xdc, 0xdd: // array 16, 32
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return err
+		}
+		return r.array(b, n)
+	case 0xde, 0xdf: // map 16, 32
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return err
+		}
+		return r.object(b, n)
+	default:
+		return fmt.Errorf("unsupported type 0x%02x", c)
+	}
+	return nil
+}
+
+// string writes the next n bytes to b as a JSON String.
+func (r *msgpackReader) string(b *bytes.Buffer, n uint64) error {
+	s, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	writeJSONString(b, string(s))
+	return nil
+}
+
+// array converts the next n values to a JSON Array.
+func (r *msgpackReader) array(b *bytes.Buffer, n uint64) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	b.WriteByte('[')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := r.value(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(']')
+	return nil
+}
+
+// object converts the next n key value pairs to a JSON Object.
+func (r *msgpackReader) object(b *bytes.Buffer, n uint64) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.exit()
+	b.WriteByte('{')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := r.key(b); err != nil {
+			return err
+		}
+		b.WriteByte(':')
+		if err := r.value(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+// key converts the next value, which must be a string, to a JSON String.
+func (r *msgpackReader) key(b *bytes.Buffer) error {
+	if len(r.data) == 0 {
+		return errUnexpectedEnd
+	}
+	if c := r.data[0]; c&0xe0 != 0xa0 && (c < 0xd9 || c > 0xdb) {
+		return fmt.Errorf("unsupported map key type 0x%02x", c)
+	}
+	return r.value(b)
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Selection determines how a MultiClient selects an endpoint for each
+// attempt of a Request.
+type Selection int
+
+const (
+	// RoundRobin cycles through the healthy endpoints in order.
+	RoundRobin Selection = iota
+
+	// LeastInFlight selects the healthy endpoint with the fewest
+	// outstanding requests, preferring earlier endpoints on ties.
+	LeastInFlight
+
+	// Priority selects the first healthy endpoint, so that later
+	// endpoints are only used for failover.
+	Priority
+)
+
+// MultiClient uses the embedded Client to make JSON-RPC 2.0 requests to any
+// of a set of replica Endpoints.
+//
+// Health is tracked passively. An endpoint that fails MaxFailures
+// consecutive times is ejected from selection for the Cooldown duration,
+// after which it is selected again. Transport errors and
+// ErrorUnexpectedHTTPResponse count as failures. Error Responses do not, since
+// they show that the endpoint is able to respond.
+//
+// If the Client.Breaker is not nil, endpoints with an open circuit for the
+// method are excluded from selection, like ejected endpoints.
+//
+// If all endpoints are excluded, all endpoints are considered for selection.
+//
+// A MultiClient must not be copied after first use.
+type MultiClient struct {
+	Client
+
+	// Endpoints are the URLs of the replicas, in priority order.
+	Endpoints []string
+
+	// Selection determines how an endpoint is selected.
+	Selection Selection
+
+	// MaxFailures is the number of consecutive failures after which an
+	// endpoint is ejected. If zero, endpoints are never ejected.
+	MaxFailures int
+
+	// Cooldown is how long an ejected endpoint is excluded from
+	// selection.
+	Cooldown time.Duration
+
+	mu     sync.Mutex
+	next   int
+	states map[string]*endpointState
+}
+
+// endpointState tracks the passive health of a single endpoint.
+type endpointState struct {
+	inFlight     int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Request uses mc to make a JSON-RPC 2.0 Request to one of mc.Endpoints. See
+// Client.Request for details.
+//
+// Each retry allowed by the RetryPolicy for the method selects a new endpoint,
+// preferring endpoints not yet attempted for this Request, so that retries
+// fail over to other replicas.
+//
+// If mc.Endpoints is empty an error is returned.
+func (mc *MultiClient) Request(ctx context.Context, method string,
+	params, result interface{}) error {
+
+	tried := make(map[string]bool, len(mc.Endpoints))
+	return mc.retryRequest(ctx, method, params,
+		func(ctx context.Context, id ID, reqData []byte) error {
+			url, err := mc.acquire(method, tried)
+			if err != nil {
+				return err
+			}
+			tried[url] = true
+			err = mc.request(ctx, url, method, id, reqData, result)
+			mc.release(ctx, url, err)
+			return err
+		})
+}
+
+// Notify uses mc to send a JSON-RPC 2.0 Notification to one of
+// mc.Endpoints. See Client.Notify for details.
+//
+// If mc.Endpoints is empty an error is returned.
+func (mc *MultiClient) Notify(ctx context.Context, method string,
+	params interface{}) error {
+
+	url, err := mc.acquire(method, nil)
+	if err != nil {
+		return err
+	}
+	err = mc.Client.Notify(ctx, url, method, params)
+	mc.release(ctx, url, err)
+	return err
+}
+
+// acquire selects an endpoint for method, preferring any not in tried, and
+// increments its in flight count.
+func (mc *MultiClient) acquire(method string,
+	tried map[string]bool) (string, error) {
+	if len(mc.Endpoints) == 0 {
+		return "", errors.New("jsonrpc2: MultiClient has no Endpoints")
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.states == nil {
+		mc.states = make(map[string]*endpointState, len(mc.Endpoints))
+	}
+
+	// Consider healthy endpoints not yet tried, then any healthy
+	// endpoints, and then all endpoints.
+	now := time.Now()
+	healthy := func(url string) bool {
+		return mc.state(url).healthy(now) &&
+			mc.Breaker.State(url, method) != BreakerOpen
+	}
+	candidates := mc.candidates(func(url string) bool {
+		return !tried[url] && healthy(url)
+	})
+	if len(candidates) == 0 {
+		candidates = mc.candidates(healthy)
+	}
+	if len(candidates) == 0 {
+		candidates = mc.Endpoints
+	}
+
+	var url string
+	switch mc.Selection {
+	case LeastInFlight:
+		url = candidates[0]
+		for _, u := range candidates[1:] {
+			if mc.state(u).inFlight < mc.state(url).inFlight {
+				url = u
+			}
+		}
+	case Priority:
+		url = candidates[0]
+	default:
+		url = candidates[mc.next%len(candidates)]
+		mc.next++
+	}
+	mc.state(url).inFlight++
+	return url, nil
+}
+
+// release decrements the in flight count of url and records whether err
+// indicates a failure of the endpoint.
+func (mc *MultiClient) release(ctx context.Context, url string, err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	s := mc.state(url)
+	s.inFlight--
+	if !isEndpointFailure(ctx, err) {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if mc.MaxFailures > 0 && s.failures >= mc.MaxFailures {
+		s.failures = 0
+		s.ejectedUntil = time.Now().Add(mc.Cooldown)
+	}
+}
+
+// candidates returns the mc.Endpoints for which include returns true.
+func (mc *MultiClient) candidates(include func(string) bool) []string {
+	var urls []string
+	for _, url := range mc.Endpoints {
+		if include(url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// state returns the endpointState for url, creating it if needed. The mc.mu
+// must be held.
+func (mc *MultiClient) state(url string) *endpointState {
+	s, ok := mc.states[url]
+	if !ok {
+		s = new(endpointState)
+		mc.states[url] = s
+	}
+	return s
+}
+
+// healthy returns true if s is not ejected at now.
+func (s *endpointState) healthy(now time.Time) bool {
+	return !now.Before(s.ejectedUntil)
+}
+
+// isEndpointFailure returns true if err indicates that the endpoint did not
+// respond with a valid Response. Errors caused by ctx being done, and an
+// ErrorCircuitOpen, for which the endpoint was not contacted, are not failures
+// of the endpoint.
+func isEndpointFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx != nil && ctx.Err() != nil {
+		return false
+	}
+	var jErr Error
+	var openErr ErrorCircuitOpen
+	return !errors.As(err, &jErr) && !errors.As(err, &openErr)
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replicas returns n servers whose "name" method returns the index of the
+// server.
+func replicas(n int) ([]*httptest.Server, []string) {
+	srvs := make([]*httptest.Server, n)
+	urls := make([]string, n)
+	for i := range srvs {
+		i := i
+		srvs[i] = httptest.NewServer(HTTPRequestHandler(MethodMap{
+			"name": func(context.Context, json.RawMessage) interface{} {
+				return i
+			}}, nil))
+		urls[i] = srvs[i].URL
+	}
+	return srvs, urls
+}
+
+func TestMultiClient(t *testing.T) {
+	assert := assert.New(t)
+
+	var mc MultiClient
+	assert.Error(mc.Request(nil, "name", nil, nil))
+
+	srvs, urls := replicas(3)
+	defer func() {
+		for _, srv := range srvs {
+			srv.Close()
+		}
+	}()
+
+	request := func(mc *MultiClient) int {
+		var i int
+		assert.NoError(mc.Request(nil, "name", nil, &i))
+		return i
+	}
+
+	mc = MultiClient{Endpoints: urls}
+	assert.Equal(0, request(&mc))
+	assert.Equal(1, request(&mc))
+	assert.Equal(2, request(&mc))
+	assert.Equal(0, request(&mc))
+
+	mc = MultiClient{Endpoints: urls, Selection: Priority}
+	assert.Equal(0, request(&mc))
+	assert.Equal(0, request(&mc))
+
+	mc = MultiClient{Endpoints: urls, Selection: LeastInFlight}
+	mc.acquire("name", nil)
+	assert.Equal(1, request(&mc))
+
+	// Failover to the next endpoint using retries.
+	down := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer down.Close()
+	mc = MultiClient{
+		Endpoints:   append([]string{down.URL}, urls...),
+		Selection:   Priority,
+		MaxFailures: 2,
+		Cooldown:    time.Hour,
+		Client: Client{Retry: RetryPolicy{MaxAttempts: 2,
+			UnexpectedHTTPResponse: true}},
+	}
+	assert.Equal(0, request(&mc))
+	assert.True(mc.state(down.URL).healthy(time.Now()))
+	assert.Equal(0, request(&mc))
+	assert.False(mc.state(down.URL).healthy(time.Now()))
+	assert.Equal(0, mc.state(down.URL).inFlight)
+
+	// The ejected endpoint is skipped without an attempt.
+	mc.Retry = RetryPolicy{}
+	assert.Equal(0, request(&mc))
+
+	// The ejected endpoint is selected again after the Cooldown.
+	mc.state(down.URL).ejectedUntil = time.Now()
+	assert.Error(mc.Request(nil, "name", nil, nil))
+}
+
+func TestMultiClientCircuitOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	srvs, urls := replicas(1)
+	defer srvs[0].Close()
+
+	cb := &CircuitBreaker{OpenTimeout: time.Hour}
+	cb.record(nil, urls[0], "", false, ErrorUnexpectedHTTPResponse{})
+	assert.Equal(BreakerOpen, cb.State(urls[0], "name"))
+
+	// Failing fast does not count against the endpoint, which was never
+	// contacted.
+	mc := MultiClient{Endpoints: urls, MaxFailures: 1, Cooldown: time.Hour,
+		Client: Client{Breaker: cb}}
+	assert.IsType(ErrorCircuitOpen{}, mc.Request(nil, "name", nil, nil))
+	assert.Equal(0, mc.state(urls[0]).failures)
+	assert.True(mc.state(urls[0]).healthy(time.Now()))
+	assert.False(isEndpointFailure(nil, ErrorCircuitOpen{}))
+}
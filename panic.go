@@ -0,0 +1,116 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PanicInfo describes a panic recovered from a MethodFunc, which results in
+// an Internal Error.
+//
+// Panics also occur if a MethodFunc returns a reserved ErrorCode, an
+// unexpected error, or a result or Error.Data that cannot be marshaled.
+type PanicInfo struct {
+	// Value is the value recovered from the panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+
+	// Method is the method name, and Params are the raw "params", if
+	// any, of the Request.
+	Method string
+	Params json.RawMessage
+
+	// ID is the raw "id" of the Request, which is nil for Notifications.
+	ID json.RawMessage
+}
+
+// PanicHandler receives the PanicInfo for each panic recovered from a
+// MethodFunc, for example to report it to an error tracker. The ctx is the
+// context.Context that was passed to the MethodFunc.
+type PanicHandler func(ctx context.Context, p PanicInfo)
+
+// panicOptions are set by WithPanicHandler and WithPanicData.
+type panicOptions struct {
+	handler PanicHandler
+	data    bool
+}
+
+// WithPanicHandler returns a HandlerOption that calls f with the PanicInfo of
+// each panic recovered from a MethodFunc, before the Internal Error is
+// returned. The f is called regardless of DebugMethodFunc.
+func WithPanicHandler(f PanicHandler) HandlerOption {
+	return func(h *handler) {
+		h.panics.handler = f
+	}
+}
+
+// WithPanicData returns a HandlerOption that, while DebugMethodFunc is true,
+// includes sanitized information about any panic in the Data of the Internal
+// Error returned to the client. The Data is an object with the "method", the
+// "type" of the panic value, and the "panic" value formatted as a single
+// line of at most MaxPanicDataLen bytes. The stack trace and params are
+// never included.
+//
+// This is intended for use during development, since the panic value may
+// still reveal implementation details.
+func WithPanicData() HandlerOption {
+	return func(h *handler) {
+		h.panics.data = true
+	}
+}
+
+// MaxPanicDataLen is the maximum length of the "panic" value included by
+// WithPanicData.
+const MaxPanicDataLen = 256
+
+// panicData is the Error.Data included by WithPanicData.
+type panicData struct {
+	Method string `json:"method"`
+	Type   string `json:"type"`
+	Panic  string `json:"panic"`
+}
+
+// data returns the sanitized Error.Data for p.
+func (p PanicInfo) data() json.RawMessage {
+	msg := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, fmt.Sprint(p.Value))
+	if len(msg) > MaxPanicDataLen {
+		// Avoid splitting a multi-byte character.
+		msg = strings.ToValidUTF8(msg[:MaxPanicDataLen-3], "") + "..."
+	}
+	data, _ := marshalJSON(panicData{ // This cannot cause an error.
+		Method: p.Method,
+		Type:   fmt.Sprintf("%T", p.Value),
+		Panic:  msg,
+	})
+	return data
+}
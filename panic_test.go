@@ -0,0 +1,109 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPanicHandler(t *testing.T) {
+	assert := assert.New(t)
+	var panics []PanicInfo
+	var traced []bool
+	h := HTTPRequestHandler(metricsTestMethods, nil,
+		WithTracer(new(TraceRecorder)),
+		WithPanicHandler(func(ctx context.Context, p PanicInfo) {
+			_, ok := TraceFromContext(ctx)
+			traced = append(traced, ok)
+			panics = append(panics, p)
+		}))
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+		`[{"jsonrpc":"2.0","method":"panic","params":{"a":1},"id":"x"},
+		{"jsonrpc":"2.0","method":"ok","id":1},
+		{"jsonrpc":"2.0","method":"panic"}]`)))
+
+	if !assert.Len(panics, 2) {
+		return
+	}
+	assert.Equal([]bool{true, true}, traced)
+	assert.Equal("panic", panics[0].Value)
+	assert.Equal("panic", panics[0].Method)
+	assert.Equal(json.RawMessage(`{"a":1}`), panics[0].Params)
+	assert.Equal(json.RawMessage(`"x"`), panics[0].ID)
+	assert.Contains(string(panics[0].Stack), "panic_test.go")
+	assert.Nil(panics[1].ID)
+	assert.Nil(panics[1].Params)
+
+	var ress []Response
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &ress))
+	if assert.Len(ress, 2) {
+		assert.Equal(ErrorCodeInternal, ress[0].Error.Code)
+		assert.Nil(ress[0].Error.Data)
+	}
+}
+
+func TestWithPanicData(t *testing.T) {
+	assert := assert.New(t)
+	methods := MethodMap{
+		"panic": func(_ context.Context, params json.RawMessage) interface{} {
+			var s []string
+			json.Unmarshal(params, &s)
+			panic(s[0])
+		},
+	}
+	h := HTTPRequestHandler(methods, nil, WithPanicData())
+	serve := func(msg string) Error {
+		params, _ := json.Marshal([]string{msg})
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+			`{"jsonrpc":"2.0","method":"panic","params":`+
+				string(params)+`,"id":1}`)))
+		var res Response
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		return res.Error
+	}
+
+	// Panic data is only included while debugging.
+	DebugMethodFunc = false
+	assert.Nil(serve("secret").Data)
+
+	DebugMethodFunc = true
+	defer func() { DebugMethodFunc = false }()
+	assert.Equal(map[string]interface{}{
+		"method": "panic",
+		"type":   "string",
+		"panic":  "line 1 line 2",
+	}, serve("line 1\nline 2").Data)
+
+	data := serve(strings.Repeat("é", MaxPanicDataLen)).Data
+	msg := data.(map[string]interface{})["panic"].(string)
+	assert.True(len(msg) <= MaxPanicDataLen)
+	assert.True(strings.HasSuffix(msg, "é..."))
+}
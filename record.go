@@ -0,0 +1,378 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Exchange is a single recorded Request and its Response, which is omitted
+// for Notifications.
+//
+// A Recorder writes each Exchange as a single line of JSON, and
+// HTTPReplayHandler reads them back.
+type Exchange struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Recorder records every Request and Response that passes through a wrapped
+// http.Handler or http.RoundTripper to an io.Writer as JSON lines, one
+// Exchange per line.
+//
+// Each Request of a batch request is recorded as a separate Exchange along
+// with its Response from the BatchResponse.
+//
+// Compressed bodies are decompressed, and bodies encoded using a Codec are
+// converted to JSON, before they are recorded.
+type Recorder struct {
+	// Codecs, in addition to MessagePackCodec and CBORCodec, are used to
+	// convert any body with a matching Content-Type to JSON.
+	Codecs []Codec
+
+	mu  sync.Mutex
+	w   io.Writer
+	log eventLog
+}
+
+// NewRecorder returns a Recorder that writes to w. Any errors writing to w, or
+// exchanges that cannot be recorded, are logged using lgr. If lgr is nil, the
+// default Logger from the log package is used.
+func NewRecorder(w io.Writer, lgr Logger) *Recorder {
+	return &Recorder{w: w, log: newEventLog(lgr)}
+}
+
+// Handler returns an http.Handler that records the exchanges of h, which is
+// typically returned by HTTPRequestHandler.
+func (rec *Recorder) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var reqBody bytes.Buffer
+		req.Body = readCloser{io.TeeReader(req.Body, &reqBody), req.Body}
+		resW := recordingResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(&resW, req)
+		rec.recordHTTP(req.Header, reqBody.Bytes(),
+			resW.Header(), resW.body.Bytes())
+	})
+}
+
+// RoundTripper returns an http.RoundTripper that records the exchanges made
+// using rt, which may be nil to use http.DefaultTransport. Use it as the
+// Transport of a Client to record the exchanges of the Client.
+func (rec *Recorder) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var reqBody []byte
+		if req.Body != nil {
+			var err error
+			if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			req.Body.Close()
+			req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		}
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+		if err != nil {
+			return nil, err
+		}
+		rec.recordHTTP(req.Header, reqBody, res.Header, resBody)
+		return res, nil
+	})
+}
+
+// recordHTTP converts the bodies of an HTTP request and response to JSON
+// using their headers, and then records them.
+func (rec *Recorder) recordHTTP(reqHeader http.Header, reqBody []byte,
+	resHeader http.Header, resBody []byte) {
+
+	reqBody, err := rec.bodyJSON(reqHeader, reqBody)
+	if err != nil {
+		rec.log.error("cannot record request", FieldError, err)
+		return
+	}
+	resBody, err = rec.bodyJSON(resHeader, resBody)
+	if err != nil {
+		rec.log.error("cannot record response", FieldError, err)
+		return
+	}
+	rec.record(reqBody, resBody)
+}
+
+// bodyJSON returns body as JSON, by decompressing it according to the
+// Content-Encoding in header, and converting it using any Codec matching the
+// Content-Type.
+func (rec *Recorder) bodyJSON(header http.Header, body []byte) ([]byte, error) {
+	r, err := decompressor(bytes.NewReader(body),
+		header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if body, err = ioutil.ReadAll(r); err != nil {
+		return nil, err
+	}
+	codecs := append([]Codec{MessagePackCodec, CBORCodec}, rec.Codecs...)
+	if codec := codecFor(header.Get("Content-Type"), codecs); codec != nil {
+		return codec.ToJSON(body)
+	}
+	return body, nil
+}
+
+// record writes an Exchange for each Request in reqBody, matching each with
+// the Response with the same ID in resBody. Any invalid Requests, or
+// Responses not matching a Request, are not recorded.
+func (rec *Recorder) record(reqBody, resBody []byte) {
+	rawReqs, err := splitBatch(reqBody)
+	if err != nil {
+		rec.log.error("cannot record request", FieldError, err)
+		return
+	}
+	rawRess, err := splitBatch(resBody)
+	if err != nil {
+		rec.log.error("cannot record response", FieldError, err)
+	}
+
+	// Index the Responses by their compacted ID.
+	ress := make(map[string][]json.RawMessage, len(rawRess))
+	for _, rawRes := range rawRess {
+		id, ok := rawID(rawRes)
+		if ok {
+			ress[id] = append(ress[id], rawRes)
+		}
+	}
+
+	var lines bytes.Buffer
+	for _, rawReq := range rawReqs {
+		var req Request
+		if json.Unmarshal(rawReq, &req) != nil {
+			continue
+		}
+		ex := Exchange{Request: rawReq}
+		if id, ok := rawID(rawReq); ok {
+			if len(ress[id]) == 0 {
+				continue
+			}
+			ex.Response, ress[id] = ress[id][0], ress[id][1:]
+		}
+		line, err := json.Marshal(ex)
+		if err != nil {
+			continue
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, err := lines.WriteTo(rec.w); err != nil {
+		rec.log.error("recording exchanges failed", FieldError, err)
+	}
+}
+
+// rawID returns the compacted "id" of the JSON object in data, or false if
+// it has no "id".
+func rawID(data json.RawMessage) (string, bool) {
+	var obj struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(data, &obj) != nil || obj.ID == nil {
+		return "", false
+	}
+	var id bytes.Buffer
+	if json.Compact(&id, obj.ID) != nil {
+		return "", false
+	}
+	return id.String(), true
+}
+
+// readCloser combines an io.Reader and the io.Closer of an underlying
+// io.ReadCloser.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordingResponseWriter records all bytes written to an http.ResponseWriter.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// roundTripperFunc allows a func to be used as an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// replay responds to Requests with recorded Responses.
+type replay struct {
+	h *handler
+
+	mu        sync.Mutex
+	exchanges map[string][]json.RawMessage
+}
+
+// HTTPReplayHandler returns an http.HandlerFunc that responds to Requests
+// using the exchanges recorded by a Recorder, which are read from r.
+//
+// Requests are matched to recorded Requests by method name and params,
+// ignoring the ID, whitespace and the order of object members. Each matching
+// recorded Response is returned in turn, repeating the last once they are
+// exhausted. The Response uses the ID of the received Request.
+//
+// An Internal Error is returned for a Request that matches no recorded
+// Request with a Response.
+//
+// The handler uses lgr and any opts like HTTPRequestHandler, see
+// HandlerOption.
+//
+// An error is returned if r cannot be read or contains an invalid Exchange.
+func HTTPReplayHandler(r io.Reader, lgr Logger,
+	opts ...HandlerOption) (http.HandlerFunc, error) {
+
+	rp := replay{exchanges: make(map[string][]json.RawMessage)}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<30)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(s.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		if ex.Request == nil {
+			return nil, fmt.Errorf(`line %v: missing "request"`, line)
+		}
+		var req Request
+		if err := json.Unmarshal(ex.Request, &req); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		if ex.Response == nil {
+			continue
+		}
+		key, err := replayKey(req)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		rp.exchanges[key] = append(rp.exchanges[key], ex.Response)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	h := handler{log: newEventLog(lgr), process: rp.process}
+	rp.h = &h
+	for _, opt := range opts {
+		opt(&h)
+	}
+	return h.ServeHTTP, nil
+}
+
+// process returns the recorded Response for each Request in rawReqs, omitting
+// any for Notifications.
+func (rp *replay) process(_ context.Context,
+	rawReqs []json.RawMessage) BatchResponse {
+
+	responses := make(BatchResponse, 0, len(rawReqs))
+	for _, rawReq := range rawReqs {
+		req, err := rp.h.unmarshalRequest(rawReq)
+		if err != nil {
+			responses = append(responses,
+				invalidRequestResponse(req, err))
+			continue
+		}
+		id := req.ID.(json.RawMessage)
+		if id == nil {
+			continue
+		}
+		res := rp.response(req)
+		res.ID = id
+		res.version1 = req.version1
+		responses = append(responses, res)
+	}
+	return responses
+}
+
+// response returns the next recorded Response for req.
+func (rp *replay) response(req Request) Response {
+	key, err := replayKey(req)
+	if err != nil {
+		return Response{Error: errorInternal(err.Error())}
+	}
+
+	rp.mu.Lock()
+	rawRess := rp.exchanges[key]
+	if len(rawRess) > 1 {
+		rp.exchanges[key] = rawRess[1:]
+	}
+	rp.mu.Unlock()
+	if len(rawRess) == 0 {
+		return Response{Error: errorInternal("no recorded Response")}
+	}
+
+	res, ok := parseBackendResponse(rawRess[0],
+		decodeOptions{policy: rp.h.decode})
+	if !ok {
+		return Response{Error: errorInternal("invalid recorded Response")}
+	}
+	return res
+}
+
+// replayKey returns the method name and canonical params of req.
+func replayKey(req Request) (string, error) {
+	key := req.Method
+	params := req.Params.(json.RawMessage)
+	if params == nil {
+		return key, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(params))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return key + "\x00" + string(canonical), nil
+}
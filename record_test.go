@@ -0,0 +1,187 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderAndReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	var count int
+	methods := MethodMap{
+		"count": func(context.Context, json.RawMessage) interface{} {
+			count++
+			return count
+		},
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		},
+	}
+
+	// Record the exchanges of a handler.
+	var handlerLog bytes.Buffer
+	rec := NewRecorder(&handlerLog, nil)
+	srv := httptest.NewServer(rec.Handler(HTTPRequestHandler(methods, nil)))
+	defer srv.Close()
+
+	// Record the exchanges of a Client.
+	var clientLog bytes.Buffer
+	var c Client
+	c.Transport = NewRecorder(&clientLog, nil).RoundTripper(nil)
+
+	var n int
+	assert.NoError(c.Request(nil, srv.URL, "count", nil, &n))
+	assert.Equal(1, n)
+	assert.NoError(c.Request(nil, srv.URL, "count", nil, &n))
+	assert.Equal(2, n)
+	assert.NoError(c.Notify(nil, srv.URL, "count", nil))
+	assert.Equal(handlerLog.String(), clientLog.String())
+
+	http.Post(srv.URL, "", strings.NewReader(`[
+		{"jsonrpc":"2.0","method":"echo","params":{"b":1,"a":[2]},"id":"x"},
+		{"jsonrpc":"2.0","method":"echo","params":[3],"id":"y"},
+		{"foo":"boo"},
+		{"jsonrpc":"2.0","method":"missing","id":"z"}
+	]`))
+
+	lines := strings.Split(strings.TrimSpace(handlerLog.String()), "\n")
+	if assert.Len(lines, 6) {
+		var ex Exchange
+		assert.NoError(json.Unmarshal([]byte(lines[2]), &ex))
+		assert.Contains(string(ex.Request), `"method":"count"`)
+		assert.Nil(ex.Response)
+		assert.Equal(`{"request":{"jsonrpc":"2.0","method":"echo","params":[3],"id":"y"},`+
+			`"response":{"jsonrpc":"2.0","result":[3],"id":"y"}}`, lines[4])
+	}
+
+	// Replay the recorded exchanges.
+	h, err := HTTPReplayHandler(&handlerLog, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	replaySrv := httptest.NewServer(h)
+	defer replaySrv.Close()
+	c = Client{}
+	assert.NoError(c.Request(nil, replaySrv.URL, "count", nil, &n))
+	assert.Equal(1, n)
+	assert.NoError(c.Request(nil, replaySrv.URL, "count", nil, &n))
+	assert.Equal(2, n)
+	assert.NoError(c.Request(nil, replaySrv.URL, "count", nil, &n))
+	assert.Equal(2, n)
+	assert.Equal(3, count)
+
+	var result map[string]interface{}
+	assert.NoError(c.Request(nil, replaySrv.URL, "echo",
+		map[string]interface{}{"a": []int{2}, "b": 1}, &result))
+	assert.Equal(map[string]interface{}{"a": []interface{}{2.0}, "b": 1.0},
+		result)
+	assert.Equal(errorMethodNotFound("missing"),
+		c.Request(nil, replaySrv.URL, "missing", nil, nil))
+	assert.Equal(errorInternal("no recorded Response"),
+		c.Request(nil, replaySrv.URL, "echo", nil, nil))
+
+	_, err = HTTPReplayHandler(strings.NewReader("{}\n"), nil)
+	assert.EqualError(err, `line 1: missing "request"`)
+	_, err = HTTPReplayHandler(strings.NewReader(`{"request":{}}`), nil)
+	assert.EqualError(err, `line 1: invalid "jsonrpc" version: ""`)
+}
+
+func TestRecorderLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var handlerLog, errLog bytes.Buffer
+	rec := NewRecorder(&handlerLog, log.New(&errLog, "", 0))
+	srv := httptest.NewServer(rec.Handler(HTTPRequestHandler(MethodMap{}, nil)))
+	defer srv.Close()
+
+	// Exchanges that cannot be recorded are logged.
+	res, err := http.Post(srv.URL, "", strings.NewReader(`[{]`))
+	if assert.NoError(err) {
+		res.Body.Close()
+	}
+	assert.Empty(handlerLog.String())
+	assert.Contains(errLog.String(), "jsonrpc2: cannot record request")
+}
+
+func TestRecorderCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	methods := MethodMap{
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		},
+	}
+
+	// Record the exchanges of a handler that supports MessagePack.
+	var handlerLog, errLog bytes.Buffer
+	rec := NewRecorder(&handlerLog, log.New(&errLog, "", 0))
+	srv := httptest.NewServer(rec.Handler(HTTPRequestHandler(methods, nil,
+		WithCodecs(MessagePackCodec))))
+	defer srv.Close()
+
+	// Record the exchanges of a Client that uses MessagePack.
+	var clientLog bytes.Buffer
+	c := Client{Codec: MessagePackCodec}
+	c.Transport = NewRecorder(&clientLog, nil).RoundTripper(nil)
+
+	var result []string
+	assert.NoError(c.Request(nil, srv.URL, "echo", []string{"a"}, &result))
+	assert.Equal([]string{"a"}, result)
+	assert.Contains(handlerLog.String(), `"result":["a"]`)
+	assert.Equal(handlerLog.String(), clientLog.String())
+	assert.Empty(errLog.String())
+}
+
+func TestRecorderCompressed(t *testing.T) {
+	assert := assert.New(t)
+
+	// Record the exchanges of a handler that compresses its Responses.
+	var handlerLog, errLog bytes.Buffer
+	rec := NewRecorder(&handlerLog, log.New(&errLog, "", 0))
+	srv := httptest.NewServer(rec.Handler(HTTPRequestHandler(
+		compressTestMethods, nil,
+		WithCompression(Compression{MinBytes: 1}))))
+	defer srv.Close()
+
+	// Record the exchanges of a Client that compresses its Requests.
+	var clientLog bytes.Buffer
+	c := Client{Compression: &Compression{}}
+	c.Transport = NewRecorder(&clientLog, nil).RoundTripper(nil)
+
+	var s string
+	assert.NoError(c.Request(nil, srv.URL, "repeat",
+		map[string]interface{}{"S": "a", "N": 3}, &s))
+	assert.Equal("aaa", s)
+	assert.Contains(handlerLog.String(), `"result":"aaa"`)
+	assert.Equal(handlerLog.String(), clientLog.String())
+	assert.Empty(errLog.String())
+}
@@ -0,0 +1,274 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrorDefinition defines an application ErrorCode of a service.
+type ErrorDefinition struct {
+	Code    ErrorCode
+	Message string
+
+	// Description documents when the error occurs.
+	Description string
+
+	// Type is a value of the Go error type for the Code, usually a nil
+	// pointer, for example (*InsufficientFundsError)(nil). The Error
+	// "data" is the JSON encoding of the error value, so the exported
+	// fields of the type define the schema of the "data".
+	//
+	// If Type is nil, the Code has no Go error type or "data".
+	Type error
+}
+
+// ErrorRegistry maps application ErrorCodes to Go error types, which define
+// the schema of the Error "data".
+//
+// Set Client.Errors to return typed errors from a Client, use Rule with
+// WithErrorMapper to return typed errors from MethodFuncs, and use
+// WriteMarkdown to document the ErrorCodes of a service.
+//
+// An ErrorRegistry must not be modified concurrently with its use. The zero
+// value is ready to use.
+type ErrorRegistry struct {
+	codes map[ErrorCode]ErrorDefinition
+	types map[reflect.Type]ErrorCode
+}
+
+// Register adds defs to r. This panics if a Code is reserved, other than a
+// server error code such as ErrorCodeRateLimited, or if a Code or Type is
+// already registered.
+func (r *ErrorRegistry) Register(defs ...ErrorDefinition) {
+	if r.codes == nil {
+		r.codes = make(map[ErrorCode]ErrorDefinition)
+		r.types = make(map[reflect.Type]ErrorCode)
+	}
+	for _, def := range defs {
+		if def.Code.IsReserved() && !def.Code.IsServerError() {
+			panic(fmt.Errorf("invalid use of %v", def.Code))
+		}
+		if _, ok := r.codes[def.Code]; ok {
+			panic(fmt.Errorf("%v already registered", def.Code))
+		}
+		if def.Type != nil {
+			typ := reflect.TypeOf(def.Type)
+			if code, ok := r.types[typ]; ok {
+				panic(fmt.Errorf("%v already registered for %v",
+					typ, code))
+			}
+			r.types[typ] = def.Code
+		}
+		r.codes[def.Code] = def
+	}
+}
+
+// Definitions returns all registered ErrorDefinitions sorted by Code.
+func (r *ErrorRegistry) Definitions() []ErrorDefinition {
+	defs := make([]ErrorDefinition, 0, len(r.codes))
+	for _, def := range r.codes {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return defs
+}
+
+// Lookup returns the ErrorDefinition for code, or false if it is not
+// registered.
+func (r *ErrorRegistry) Lookup(code ErrorCode) (ErrorDefinition, bool) {
+	def, ok := r.codes[code]
+	return def, ok
+}
+
+// Rule returns an ErrorRule for WithErrorMapper that maps any error of a
+// registered Type, or that wraps one, to an Error with its Code, Message and
+// the error value as the Data.
+func (r *ErrorRegistry) Rule() ErrorRule {
+	return func(err error) (Error, bool) {
+		for err != nil {
+			if code, ok := r.types[reflect.TypeOf(err)]; ok {
+				def := r.codes[code]
+				return Error{Code: def.Code, Message: def.Message,
+					Data: err}, true
+			}
+			err = errors.Unwrap(err)
+		}
+		return Error{}, false
+	}
+}
+
+// typed returns e as a typed error if e.Code is registered with a Type, by
+// decoding data, the raw "data" of e, into a new value of the Type. If e.Code
+// is not registered, e is returned. If data cannot be decoded, the returned
+// error wraps the decode error, and errors.As can still be used to retrieve
+// e.
+func (r *ErrorRegistry) typed(e Error, data json.RawMessage) error {
+	if r == nil {
+		return e
+	}
+	def, ok := r.codes[e.Code]
+	if !ok || def.Type == nil {
+		return e
+	}
+	typ := reflect.TypeOf(def.Type)
+	v := reflect.New(typ)
+	if typ.Kind() == reflect.Ptr {
+		v.Elem().Set(reflect.New(typ.Elem()))
+	}
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return typedError{e,
+				fmt.Errorf("jsonrpc2: decoding %v data: %w", e.Code, err)}
+		}
+	}
+	return typedError{e, v.Elem().Interface().(error)}
+}
+
+// typedError is returned by a Client for an Error with a registered Type.
+// Its Error method and Unwrap return the typed error, or the error decoding
+// it, and errors.As can also be used to retrieve the Error.
+type typedError struct {
+	e   Error
+	err error
+}
+
+func (err typedError) Error() string {
+	return err.err.Error()
+}
+
+func (err typedError) Unwrap() error {
+	return err.err
+}
+
+// As sets target to the Error if it is an *Error.
+func (err typedError) As(target interface{}) bool {
+	if e, ok := target.(*Error); ok {
+		*e = err.e
+		return true
+	}
+	return false
+}
+
+// WriteMarkdown writes a Markdown table documenting the registered
+// ErrorCodes to w, with the code, message, a schema of the "data" derived
+// from the Type, and the description.
+func (r *ErrorRegistry) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("| Code | Message | Data | Description |\n")
+	b.WriteString("| ---: | --- | --- | --- |\n")
+	for _, def := range r.Definitions() {
+		data := ""
+		if def.Type != nil {
+			data = "`" + dataSchema(reflect.TypeOf(def.Type), 0) + "`"
+		}
+		fmt.Fprintf(&b, "| %v | %v | %v | %v |\n", int(def.Code),
+			markdownCell(def.Message), markdownCell(data),
+			markdownCell(def.Description))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownCell escapes s for use in a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// maxSchemaDepth limits the depth of nested types described by dataSchema.
+const maxSchemaDepth = 5
+
+// dataSchema describes the JSON encoding of typ.
+func dataSchema(typ reflect.Type, depth int) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if depth > maxSchemaDepth {
+		return "..."
+	}
+	if typ.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+		return "any"
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "[" + dataSchema(typ.Elem(), depth+1) + "]"
+	case reflect.Map:
+		return "{string: " + dataSchema(typ.Elem(), depth+1) + "}"
+	case reflect.Struct:
+		var fields []string
+		structFields(typ, func(name string, f reflect.StructField) {
+			fields = append(fields, fmt.Sprintf("%q: %v", name,
+				dataSchema(f.Type, depth+1)))
+		})
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return "any"
+}
+
+// structFields calls f with the JSON name of each exported field of typ, as
+// encoded by json.Marshal, including the fields of embedded structs.
+func structFields(typ reflect.Type, f func(string, reflect.StructField)) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				structFields(embedded, f)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		f(name, field)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type insufficientFundsError struct {
+	Balance int `json:"balance"`
+	Needed  int `json:"needed"`
+}
+
+func (err *insufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds: %v < %v", err.Balance, err.Needed)
+}
+
+type lockedError struct {
+	Until   string   `json:"until,omitempty"`
+	Reasons []string `json:"reasons"`
+	private int
+}
+
+func (err lockedError) Error() string {
+	return "locked until " + err.Until
+}
+
+func newTestErrorRegistry() *ErrorRegistry {
+	var r ErrorRegistry
+	r.Register(ErrorDefinition{
+		Code:        1001,
+		Message:     "insufficient funds",
+		Description: "The balance is too low.",
+		Type:        (*insufficientFundsError)(nil),
+	}, ErrorDefinition{
+		Code:        1002,
+		Message:     "locked",
+		Description: "The account is locked | frozen.",
+		Type:        lockedError{},
+	}, ErrorDefinition{
+		Code:    1000,
+		Message: "untyped",
+	})
+	return &r
+}
+
+func TestErrorRegistryRegister(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestErrorRegistry()
+
+	def, ok := r.Lookup(1001)
+	assert.True(ok)
+	assert.Equal("insufficient funds", def.Message)
+	_, ok = r.Lookup(1)
+	assert.False(ok)
+
+	codes := []ErrorCode{}
+	for _, def := range r.Definitions() {
+		codes = append(codes, def.Code)
+	}
+	assert.Equal([]ErrorCode{1000, 1001, 1002}, codes)
+
+	assert.Panics(func() {
+		r.Register(ErrorDefinition{Code: ErrorCodeInternal})
+	}, "reserved")
+	assert.NotPanics(func() {
+		r.Register(ErrorDefinition{Code: ErrorCodeRateLimited})
+	}, "server error code")
+	assert.Panics(func() {
+		r.Register(ErrorDefinition{Code: 1001})
+	}, "duplicate code")
+	assert.Panics(func() {
+		r.Register(ErrorDefinition{Code: 1003, Type: lockedError{}})
+	}, "duplicate type")
+}
+
+func TestErrorRegistryClient(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestErrorRegistry()
+	methods := MethodMap{
+		"funds": func(context.Context, json.RawMessage) interface{} {
+			return fmt.Errorf("transfer: %w",
+				&insufficientFundsError{Balance: 1, Needed: 2})
+		},
+		"locked": func(context.Context, json.RawMessage) interface{} {
+			return lockedError{Until: "tomorrow"}
+		},
+		"untyped": func(context.Context, json.RawMessage) interface{} {
+			return NewError(1000, "untyped", "data")
+		},
+		"bad data": func(context.Context, json.RawMessage) interface{} {
+			return NewError(1001, "insufficient funds", "data")
+		},
+	}
+	srv := httptest.NewServer(HTTPRequestHandler(methods, nil,
+		WithErrorMapper(r.Rule())))
+	defer srv.Close()
+
+	c := Client{Errors: r}
+	err := c.Request(nil, srv.URL, "funds", nil, nil)
+	var funds *insufficientFundsError
+	if assert.True(errors.As(err, &funds)) {
+		assert.Equal(&insufficientFundsError{Balance: 1, Needed: 2}, funds)
+	}
+	assert.Equal(funds.Error(), err.Error())
+	var e Error
+	if assert.True(errors.As(err, &e)) {
+		assert.Equal(ErrorCode(1001), e.Code)
+		assert.Equal("insufficient funds", e.Message)
+	}
+
+	err = c.Request(nil, srv.URL, "locked", nil, nil)
+	var locked lockedError
+	if assert.True(errors.As(err, &locked)) {
+		assert.Equal("tomorrow", locked.Until)
+	}
+
+	err = c.Request(nil, srv.URL, "untyped", nil, nil)
+	assert.Equal(NewError(1000, "untyped", "data"), err)
+
+	// Data that does not match the Type results in the decode error,
+	// which still wraps the Error.
+	err = c.Request(nil, srv.URL, "bad data", nil, nil)
+	var decodeErr *json.UnmarshalTypeError
+	assert.True(errors.As(err, &decodeErr))
+	if assert.True(errors.As(err, &e)) {
+		assert.Equal(NewError(1001, "insufficient funds", "data"), e)
+	}
+
+	// Without a registry, the Error is returned.
+	c.Errors = nil
+	err = c.Request(nil, srv.URL, "funds", nil, nil)
+	assert.IsType(Error{}, err)
+}
+
+type retryAfterError struct {
+	Seconds int `json:"seconds"`
+}
+
+func (err retryAfterError) Error() string {
+	return fmt.Sprintf("retry after %vs", err.Seconds)
+}
+
+func TestErrorRegistryServerError(t *testing.T) {
+	assert := assert.New(t)
+	var r ErrorRegistry
+	r.Register(ErrorDefinition{
+		Code:    ErrorCodeRateLimited,
+		Message: ErrorMessageRateLimited,
+		Type:    retryAfterError{},
+	})
+	srv := httptest.NewServer(HTTPRequestHandler(MethodMap{
+		"limited": func(context.Context, json.RawMessage) interface{} {
+			return retryAfterError{Seconds: 3}
+		}}, nil, WithErrorMapper(r.Rule())))
+	defer srv.Close()
+
+	c := Client{Errors: &r}
+	err := c.Request(nil, srv.URL, "limited", nil, nil)
+	var retryAfter retryAfterError
+	if assert.True(errors.As(err, &retryAfter)) {
+		assert.Equal(3, retryAfter.Seconds)
+	}
+	var e Error
+	if assert.True(errors.As(err, &e)) {
+		assert.Equal(ErrorCodeRateLimited, e.Code)
+	}
+}
+
+func TestErrorRegistryWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newTestErrorRegistry().WriteMarkdown(&buf))
+	assert.Equal(t, "| Code | Message | Data | Description |\n"+
+		"| ---: | --- | --- | --- |\n"+
+		"| 1000 | untyped |  |  |\n"+
+		"| 1001 | insufficient funds | "+
+		"`{\"balance\": number, \"needed\": number}` | "+
+		"The balance is too low. |\n"+
+		"| 1002 | locked | "+
+		"`{\"until\": string, \"reasons\": [string]}` | "+
+		`The account is locked \| frozen. |`+"\n", buf.String())
+}
@@ -21,7 +21,6 @@
 package jsonrpc2
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -53,7 +52,14 @@ type Request struct {
 	// If it is not included it is assumed to be a notification. The value
 	// SHOULD normally not be Null and Numbers SHOULD NOT contain
 	// fractional parts.
+	//
+	// Use an ID to preserve the exact "id" of a received Request or to
+	// compare it with the "id" of a Response.
 	ID interface{} `json:"id,omitempty"`
+
+	// version1 is true if the Request uses JSON-RPC 1.0 format. See
+	// WithVersion1.
+	version1 bool
 }
 
 // jRequest adds the required "jsonrpc" field and allows for detecting if the
@@ -91,9 +97,9 @@ type request Request
 //
 // If r.ID is not nil, then the returned data represents a Request. Also, an
 // `invalid "id": ...` error is returned if the r.ID does not marshal into a
-// valid JSON number, string, or null. Although technically permitted, it is
-// not recommended to use json.RawMessage("null") as an ID, as this is used by
-// Responses when there is an error parsing "id".
+// valid JSON number without a fractional part, string, or null. Although
+// technically permitted, it is not recommended to use json.RawMessage("null")
+// as an ID, as this is used by Responses when there is an error parsing "id".
 //
 // If r.Params is not nil, then an `invalid "params": ...` error is returned if
 // it does not marshal into a valid JSON object, array, or null.
@@ -101,13 +107,16 @@ type request Request
 // An empty Method, though not recommended, is technically valid and does not
 // cause an error.
 func (r Request) MarshalJSON() ([]byte, error) {
+	if r.version1 {
+		return r.marshalJSON1()
+	}
 	jR := jRequest{
 		JSONRPC: version,
 		Method:  &r.Method,
 		request: (*request)(&r),
 	}
 	if r.ID != nil {
-		id, err := json.Marshal(r.ID)
+		id, err := marshalJSON(r.ID)
 		if err != nil {
 			return nil, fmt.Errorf(`invalid "id": %w`, err)
 		}
@@ -126,7 +135,7 @@ func (r Request) MarshalJSON() ([]byte, error) {
 		}
 		r.Params = json.RawMessage(params)
 	}
-	return json.Marshal(jR)
+	return marshalJSON(jR)
 }
 
 // UnmarshalJSON attempts to unmarshal a JSON-RPC 2.0 Request or Notification
@@ -154,47 +163,61 @@ func (r Request) MarshalJSON() ([]byte, error) {
 // If the "method" field is omitted or null, a `missing "method"` error is
 // returned. An explicitly empty "method" string does not cause an error.
 //
-// If the "id" value is not a JSON number, string, or null, an `invalid "id":
-// ...` error is returned.
+// If the "id" value is not a JSON number, string, or null, or is a number with
+// a fractional part, an `invalid "id": ...` error is returned. See IDPolicy.
 //
 // If the "params" value is not a JSON array, object, or null, an `invalid
 // "params": ...` error is returned.
 func (r *Request) UnmarshalJSON(data []byte) error {
+	return r.unmarshalJSON(data, decodeOptions{})
+}
+
+// unmarshalJSON implements UnmarshalJSON using o to validate "id" and
+// tolerate any deviations allowed by its DecodePolicy.
+func (r *Request) unmarshalJSON(data []byte, o decodeOptions) error {
 	// params stores the "params" JSON if it is not omitted or null.
 	var params json.RawMessage
 	r.Params = &params
 	jR := jRequest{request: (*request)(r)}
 
-	d := json.NewDecoder(bytes.NewBuffer(data))
-	d.DisallowUnknownFields()
-	if err := d.Decode(&jR); err != nil {
+	if err := o.newDecoder(data).Decode(&jR); err != nil {
 		return err
 	}
 
-	if jR.JSONRPC != version {
-		return fmt.Errorf(`invalid "jsonrpc" version: %q`, jR.JSONRPC)
+	version1, err := o.checkVersion(data, jR.JSONRPC)
+	if err != nil {
+		return err
 	}
+	r.version1 = version1
 
 	if jR.Method == nil {
 		return fmt.Errorf(`missing "method"`)
 	}
 	r.Method = *jR.Method
 
+	if version1 && string(jR.ID) == "null" {
+		// JSON-RPC 1.0 Notifications have a null "id".
+		jR.ID = nil
+	}
 	if jR.ID != nil {
-		if err := validateID(jR.ID); err != nil {
+		if err := o.ids.validateID(jR.ID); err != nil {
 			return err
 		}
 	}
 	r.ID = jR.ID
 
 	if params != nil {
-		if err := validateParams(params); err != nil {
+		validate := validateParams
+		if version1 {
+			validate = validateParams1
+		}
+		if err := validate(params); err != nil {
 			return err
 		}
 	}
 	r.Params = params
 
-	return nil
+	return o.checkUnknownFields(data, "jsonrpc", "method", "params", "id")
 }
 
 // String returns r as a JSON object prefixed with "--> " to indicate an
@@ -203,7 +226,7 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 // If r.MarshalJSON returns an error then the error string is returned with
 // some context.
 func (r Request) String() string {
-	b, err := json.Marshal(r)
+	b, err := marshalJSON(r)
 	if err != nil {
 		return fmt.Sprintf("%#v.MarshalJSON(): %v", r, err)
 	}
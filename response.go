@@ -21,7 +21,6 @@
 package jsonrpc2
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -42,7 +41,8 @@ const version = "2.0"
 // value that the "result" can be unmarshaled into, if known prior to
 // unmarshaling. Similarly, it is recommended to set ID to a pointer to a value
 // that the "id" can be unmarshaled into, which should be the same type as the
-// Request ID.
+// Request ID. Use a *ID to preserve the exact "id" for comparison with the ID
+// of the Request.
 type Response struct {
 	// Result is REQUIRED on success. This member MUST NOT exist if there
 	// was an error invoking the method. The value of this member is
@@ -64,6 +64,10 @@ type Response struct {
 	// Request Object. If there was an error in detecting the id in the
 	// Request Object (e.g. Parse error/Invalid Request), it MUST be Null.
 	ID interface{} `json:"id"`
+
+	// version1 is true if the Response uses JSON-RPC 1.0 format. See
+	// WithVersion1.
+	version1 bool
 }
 
 // jResponse adds the required "jsonrpc" field and allows for detecting if the
@@ -117,7 +121,10 @@ func (r Response) MarshalJSON() ([]byte, error) {
 			r.Result = json.RawMessage("null")
 		}
 	}
-	return json.Marshal(jR)
+	if r.version1 {
+		return r.marshalJSON1()
+	}
+	return marshalJSON(jR)
 }
 
 // UnmarshalJSON attempts to unmarshal a JSON-RPC 2.0 Response into r and then
@@ -127,11 +134,18 @@ func (r Response) MarshalJSON() ([]byte, error) {
 // "result" object, an error is returned.
 //
 // If "error" and "result" are both present or not null, a `contains both ...`
+// error is returned. If neither is present, a `missing "result" or "error"`
 // error is returned.
 //
 // If the "jsonrpc" field is not set to the string "2.0", an `invalid "jsonrpc"
 // version: ...` error is returned.
 func (r *Response) UnmarshalJSON(data []byte) error {
+	return r.unmarshalJSON(data, decodeOptions{})
+}
+
+// unmarshalJSON implements UnmarshalJSON, tolerating any deviations allowed by
+// the DecodePolicy of o.
+func (r *Response) unmarshalJSON(data []byte, o decodeOptions) error {
 	// There may be fields in the result not defined in the user provided
 	// r.Result, which will cause errors with the json.Decoder below.  So
 	// first unmarshal any "result" to a json.RawMessage, which will later
@@ -142,26 +156,53 @@ func (r *Response) UnmarshalJSON(data []byte) error {
 	jR := jResponse{Error: &r.Error, response: (*response)(r)}
 
 	// Catch any unknown fields in the top level JSON RPC Response object.
-	d := json.NewDecoder(bytes.NewBuffer(data))
-	d.DisallowUnknownFields()
-	if err := d.Decode(&jR); err != nil {
+	if err := o.newDecoder(data).Decode(&jR); err != nil {
 		return err
 	}
 
-	if jR.JSONRPC != version {
-		return fmt.Errorf(`invalid "jsonrpc" version: %q`, jR.JSONRPC)
+	version1, err := o.checkVersion(data, jR.JSONRPC)
+	if err != nil {
+		return err
 	}
+	r.version1 = version1
 
 	if r.HasError() {
 		if resultData != nil {
 			return fmt.Errorf(`contains both "result" and "error"`)
 		}
-		return nil
+		return o.checkUnknownFields(data, "jsonrpc", "result", "error", "id")
 	}
 
 	// Restore the userResult and finish unmarshaling.
 	r.Result = userResult
-	return json.Unmarshal(resultData, &r.Result)
+	if resultData == nil {
+		// The resultData is nil if "result" was omitted or null, but
+		// only a null "result" is valid without an "error".
+		fields, err := topLevelFields(data)
+		if err != nil {
+			return err
+		}
+		if _, ok := fields["result"]; !ok {
+			return fmt.Errorf(`missing "result" or "error"`)
+		}
+		resultData = json.RawMessage("null")
+	}
+	if err := json.Unmarshal(resultData, &r.Result); err != nil {
+		return err
+	}
+	return o.checkUnknownFields(data, "jsonrpc", "result", "error", "id")
+}
+
+// responseUnmarshaler allows json.Unmarshal to be used to unmarshal a
+// Response using decodeOptions.
+type responseUnmarshaler struct {
+	*Response
+	o decodeOptions
+}
+
+// UnmarshalJSON calls r.Response.unmarshalJSON with r.o.
+func (r responseUnmarshaler) UnmarshalJSON(data []byte) error {
+	return r.Response.unmarshalJSON(data, r.o)
 }
 
 // HasError returns true is r.Error has any non-zero values.
@@ -58,3 +58,41 @@ func TestResponse(t *testing.T) {
 		}
 	})
 }
+
+func TestResponseUnmarshalJSON(t *testing.T) {
+	for _, test := range []struct {
+		Name string
+		Data string
+		Err  string
+	}{{
+		Name: "result",
+		Data: `{"jsonrpc":"2.0","result":5,"id":1}`,
+	}, {
+		Name: "null result",
+		Data: `{"jsonrpc":"2.0","result":null,"id":1}`,
+	}, {
+		Name: "error",
+		Data: `{"jsonrpc":"2.0","error":{"code":1,"message":"m"},"id":1}`,
+	}, {
+		Name: "missing result and error",
+		Data: `{"jsonrpc":"2.0","id":1}`,
+		Err:  `missing "result" or "error"`,
+	}, {
+		Name: "result and error",
+		Data: `{"jsonrpc":"2.0","result":5,` +
+			`"error":{"code":1,"message":"m"},"id":1}`,
+		Err: `contains both "result" and "error"`,
+	}} {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			var result int
+			res := Response{Result: &result}
+			err := res.UnmarshalJSON([]byte(test.Data))
+			if test.Err != "" {
+				assert.EqualError(t, err, test.Err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
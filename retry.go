@@ -0,0 +1,142 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy controls whether and how the Client retries a failed Request.
+//
+// The zero value never retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the base delay before the first retry. The delay doubles
+	// for each subsequent retry, up to MaxBackoff. A random jitter of up
+	// to half of the delay is subtracted from each delay.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. If zero, the delay is
+	// not capped.
+	MaxBackoff time.Duration
+
+	// TransportErrors enables retrying network errors returned by
+	// http.Client.Do.
+	TransportErrors bool
+
+	// UnexpectedHTTPResponse enables retrying an
+	// ErrorUnexpectedHTTPResponse with a 5xx or 429 Too Many Requests
+	// status. Other statuses, such as 4xx, are not retried since they are
+	// unlikely to succeed on a later attempt.
+	UnexpectedHTTPResponse bool
+
+	// ErrorCodes lists the ErrorCodes of Error Responses that may be
+	// retried.
+	ErrorCodes []ErrorCode
+}
+
+// retryPolicy returns the RetryPolicy for method.
+func (c *Client) retryPolicy(method string) RetryPolicy {
+	if c.NonIdempotent[method] {
+		return RetryPolicy{}
+	}
+	if p, ok := c.MethodRetry[method]; ok {
+		return p
+	}
+	return c.Retry
+}
+
+// wait returns false if err should not be retried after the given attempt.
+// Otherwise it sleeps for the backoff delay and returns true, unless ctx is
+// done first.
+func (p RetryPolicy) wait(ctx context.Context, attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+		return false
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	t := time.NewTimer(p.backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// retryable returns true if err is a kind of error enabled by p.
+func (p RetryPolicy) retryable(err error) bool {
+	var jErr Error
+	if errors.As(err, &jErr) {
+		for _, code := range p.ErrorCodes {
+			if jErr.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+	var resErr ErrorUnexpectedHTTPResponse
+	if errors.As(err, &resErr) {
+		return p.UnexpectedHTTPResponse && resErr.Response != nil &&
+			(resErr.StatusCode >= 500 ||
+				resErr.StatusCode == http.StatusTooManyRequests)
+	}
+	// http.Client.Do returns all transport errors as a *url.Error.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return p.TransportErrors
+	}
+	return false
+}
+
+// backoff returns the delay before the retry that follows the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d <= math.MaxInt64/2; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Subtract up to half of the delay so that concurrent clients do not
+	// retry in lockstep.
+	return d - time.Duration(rand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer returns a server that fails with a 503 status for the first
+// failures requests and then calls the methods.
+func flakyServer(failures int32, methods MethodMap) (*httptest.Server, *int32) {
+	var count int32
+	h := HTTPRequestHandler(methods, nil)
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&count, 1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			h(w, req)
+		}))
+	return srv, &count
+}
+
+func TestClientRetry(t *testing.T) {
+	methods := MethodMap{
+		"ok":    func(context.Context, json.RawMessage) interface{} { return true },
+		"error": func(context.Context, json.RawMessage) interface{} { return Error{Code: 7} },
+	}
+	policy := RetryPolicy{
+		MaxAttempts:            3,
+		Backoff:                time.Millisecond,
+		UnexpectedHTTPResponse: true,
+		ErrorCodes:             []ErrorCode{7},
+	}
+
+	t.Run("success after failures", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(2, methods)
+		defer srv.Close()
+		c := Client{Retry: policy}
+		var result bool
+		assert.NoError(c.Request(nil, srv.URL, "ok", nil, &result))
+		assert.True(result)
+		assert.Equal(int32(3), *count)
+	})
+
+	t.Run("too many failures", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(3, methods)
+		defer srv.Close()
+		c := Client{Retry: policy}
+		err := c.Request(nil, srv.URL, "ok", nil, nil)
+		assert.IsType(ErrorUnexpectedHTTPResponse{}, err)
+		assert.Equal(int32(3), *count)
+	})
+
+	t.Run("error code", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(0, methods)
+		defer srv.Close()
+		c := Client{Retry: policy}
+		err := c.Request(nil, srv.URL, "error", nil, nil)
+		assert.IsType(Error{}, err)
+		assert.Equal(int32(3), *count)
+	})
+
+	t.Run("method override", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(1, methods)
+		defer srv.Close()
+		c := Client{Retry: policy,
+			MethodRetry: map[string]RetryPolicy{"ok": {}}}
+		assert.Error(c.Request(nil, srv.URL, "ok", nil, nil))
+		assert.Equal(int32(1), *count)
+	})
+
+	t.Run("non-idempotent", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(1, methods)
+		defer srv.Close()
+		c := Client{Retry: policy,
+			MethodRetry:   map[string]RetryPolicy{"ok": policy},
+			NonIdempotent: map[string]bool{"ok": true}}
+		assert.Error(c.Request(nil, srv.URL, "ok", nil, nil))
+		assert.Equal(int32(1), *count)
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(1, methods)
+		defer srv.Close()
+		c := Client{Retry: policy}
+		assert.NoError(c.Notify(nil, srv.URL, "ok", nil))
+		assert.Equal(int32(1), *count)
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, _ := flakyServer(0, methods)
+		srv.Close()
+		c := Client{Retry: RetryPolicy{MaxAttempts: 2,
+			TransportErrors: true}}
+		err := c.Request(nil, srv.URL, "ok", nil, nil)
+		assert.Error(err)
+		assert.True(c.Retry.retryable(err))
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, count := flakyServer(5, methods)
+		defer srv.Close()
+		c := Client{Retry: RetryPolicy{MaxAttempts: 5, Backoff: time.Hour,
+			UnexpectedHTTPResponse: true}}
+		ctx, cancel := context.WithTimeout(context.Background(),
+			10*time.Millisecond)
+		defer cancel()
+		assert.Error(c.Request(ctx, srv.URL, "ok", nil, nil))
+		assert.Equal(int32(1), *count)
+	})
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	unexpected := func(status int) error {
+		err := ErrorUnexpectedHTTPResponse{UnmarshlingErr: errors.New("")}
+		if status != 0 {
+			err.Response = &http.Response{StatusCode: status}
+		}
+		return err
+	}
+	for _, test := range []struct {
+		Name      string
+		Policy    RetryPolicy
+		Err       error
+		Retryable bool
+	}{{
+		Name:      "503",
+		Policy:    RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:       unexpected(http.StatusServiceUnavailable),
+		Retryable: true,
+	}, {
+		Name:      "500",
+		Policy:    RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:       unexpected(http.StatusInternalServerError),
+		Retryable: true,
+	}, {
+		Name:      "429",
+		Policy:    RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:       unexpected(http.StatusTooManyRequests),
+		Retryable: true,
+	}, {
+		Name:   "400",
+		Policy: RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:    unexpected(http.StatusBadRequest),
+	}, {
+		Name:   "404",
+		Policy: RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:    unexpected(http.StatusNotFound),
+	}, {
+		Name:   "200 with mismatched id",
+		Policy: RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:    unexpected(http.StatusOK),
+	}, {
+		Name:   "no http.Response",
+		Policy: RetryPolicy{UnexpectedHTTPResponse: true},
+		Err:    unexpected(0),
+	}, {
+		Name: "disabled",
+		Err:  unexpected(http.StatusServiceUnavailable),
+	}, {
+		Name:      "error code",
+		Policy:    RetryPolicy{ErrorCodes: []ErrorCode{7}},
+		Err:       Error{Code: 7},
+		Retryable: true,
+	}, {
+		Name:   "other error code",
+		Policy: RetryPolicy{ErrorCodes: []ErrorCode{7}},
+		Err:    Error{Code: 8},
+	}} {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Retryable,
+				test.Policy.retryable(test.Err))
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	assert := assert.New(t)
+	p := RetryPolicy{Backoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond}
+	for attempt, max := range []time.Duration{10, 20, 40, 40, 40} {
+		max *= time.Millisecond
+		d := p.backoff(attempt + 1)
+		assert.True(max/2 <= d && d <= max, "attempt %v: %v", attempt+1, d)
+	}
+	p.MaxBackoff = 0
+	assert.True(p.backoff(100) > 0)
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import "fmt"
+
+// ServerError is an Error with an implementation-defined server error code,
+// from ErrorCodeMinServer to ErrorCodeMaxServer, for use by server
+// infrastructure, such as timeouts, rate limits, authentication and load
+// shedding.
+//
+// Server error codes may only be returned by a Middleware, see
+// WithMiddleware, or be mapped using WithErrorMapper. A Middleware may return
+// a ServerError, or an error that wraps one, to return its Error. Returning
+// a ServerError from a MethodFunc itself, or returning an Error with a server
+// error code directly, results in a panic, so that these codes are only used
+// deliberately. A ServerError with a code outside of the server error range
+// also results in a panic.
+type ServerError Error
+
+// NewServerError returns a ServerError with code, msg and data, like
+// NewError. If msg is empty, the message for code is used, such as
+// ErrorMessageTimeout, or ErrorMessageServer.
+//
+// This panics if code is not a server error code.
+func NewServerError(code ErrorCode, msg string, data interface{}) ServerError {
+	if !code.IsServerError() {
+		panic(fmt.Errorf("%v is not a server error code", code))
+	}
+	if msg == "" {
+		msg = serverErrorMessage(code)
+	}
+	return ServerError(NewError(code, msg, data))
+}
+
+// serverErrorMessage returns the default message for a server error code.
+func serverErrorMessage(code ErrorCode) string {
+	switch code {
+	case ErrorCodeTimeout:
+		return ErrorMessageTimeout
+	case ErrorCodeRateLimited:
+		return ErrorMessageRateLimited
+	case ErrorCodeUnauthorized:
+		return ErrorMessageUnauthorized
+	case ErrorCodeOverloaded:
+		return ErrorMessageOverloaded
+	}
+	return ErrorMessageServer
+}
+
+// ErrorTimeout returns a ServerError with ErrorCodeTimeout and data.
+func ErrorTimeout(data interface{}) ServerError {
+	return NewServerError(ErrorCodeTimeout, "", data)
+}
+
+// ErrorRateLimited returns a ServerError with ErrorCodeRateLimited and data.
+func ErrorRateLimited(data interface{}) ServerError {
+	return NewServerError(ErrorCodeRateLimited, "", data)
+}
+
+// ErrorUnauthorized returns a ServerError with ErrorCodeUnauthorized and
+// data.
+func ErrorUnauthorized(data interface{}) ServerError {
+	return NewServerError(ErrorCodeUnauthorized, "", data)
+}
+
+// ErrorOverloaded returns a ServerError with ErrorCodeOverloaded and data.
+func ErrorOverloaded(data interface{}) ServerError {
+	return NewServerError(ErrorCodeOverloaded, "", data)
+}
+
+// Error returns the Error string of e.
+func (e ServerError) Error() string {
+	return Error(e).Error()
+}
+
+// As sets target to e as an Error if it is an *Error, so that a ServerError
+// can be used like an Error with errors.As.
+func (e ServerError) As(target interface{}) bool {
+	if t, ok := target.(*Error); ok {
+		*t = Error(e)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerError(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(ServerError{ErrorCodeTimeout, ErrorMessageTimeout, "data"},
+		ErrorTimeout("data"))
+	assert.Equal(ServerError{ErrorCodeRateLimited,
+		ErrorMessageRateLimited, nil}, ErrorRateLimited(nil))
+	assert.Equal(ServerError{ErrorCodeUnauthorized,
+		ErrorMessageUnauthorized, nil}, ErrorUnauthorized(nil))
+	assert.Equal(ServerError{ErrorCodeOverloaded,
+		ErrorMessageOverloaded, nil}, ErrorOverloaded(nil))
+	assert.Equal(ServerError{-32050, ErrorMessageServer, nil},
+		NewServerError(-32050, "", nil))
+	assert.Equal(ServerError{-32050, "custom", nil},
+		NewServerError(-32050, "custom", nil))
+
+	assert.Panics(func() { NewServerError(ErrorCodeInternal, "", nil) })
+	assert.Panics(func() { NewServerError(1, "", nil) })
+
+	var e Error
+	err := fmt.Errorf("wrapped: %w", ErrorTimeout(nil))
+	if assert.True(errors.As(err, &e)) {
+		assert.Equal(ErrorCodeTimeout, e.Code)
+	}
+	assert.Equal(Error(ErrorTimeout(nil)).Error(), ErrorTimeout(nil).Error())
+}
+
+func TestMethodFuncCallServerError(t *testing.T) {
+	assert := assert.New(t)
+	call := func(ret interface{}, o callOptions) Response {
+		var f MethodFunc = func(context.Context, json.RawMessage) interface{} {
+			return ret
+		}
+		o.log = newEventLog(log.New(ioutil.Discard, "", 0))
+		return f.call(context.Background(), "", nil, o)
+	}
+
+	// A ServerError, even if wrapped, is allowed from Middleware.
+	middleware := func(ret interface{}) callOptions {
+		return callOptions{middleware: []Middleware{
+			func(MethodFunc) MethodFunc {
+				return func(context.Context,
+					json.RawMessage) interface{} {
+					return ret
+				}
+			}}}
+	}
+	res := call(nil, middleware(ErrorRateLimited("slow down")))
+	assert.Equal(Error{ErrorCodeRateLimited, ErrorMessageRateLimited,
+		json.RawMessage(`"slow down"`)}, res.Error)
+	res = call(nil, middleware(fmt.Errorf("%w", ServerError{Code: -32050})))
+	assert.Equal(Error{Code: -32050, Message: ErrorMessageServer}, res.Error)
+
+	// A plain MethodFunc may not return a ServerError, even if it is
+	// passed through by Middleware.
+	res = call(ErrorTimeout(nil), callOptions{})
+	assert.Equal(errorInternal(nil), res.Error)
+	passThrough := func(next MethodFunc) MethodFunc { return next }
+	res = call(ErrorTimeout(nil),
+		callOptions{middleware: []Middleware{passThrough}})
+	assert.Equal(errorInternal(nil), res.Error)
+
+	// Server error codes are forbidden in an Error, even from Middleware.
+	res = call(NewError(ErrorCodeTimeout, "timeout", nil), callOptions{})
+	assert.Equal(errorInternal(nil), res.Error)
+	res = call(nil, middleware(NewError(ErrorCodeTimeout, "timeout", nil)))
+	assert.Equal(errorInternal(nil), res.Error)
+
+	// A ServerError must use a server error code.
+	res = call(nil, middleware(ServerError{Code: ErrorCodeInvalidRequest}))
+	assert.Equal(errorInternal(nil), res.Error)
+
+	// The ErrorMapper may use server error codes.
+	res = call(context.DeadlineExceeded, callOptions{errors: ErrorMapper{
+		ErrorIs(context.DeadlineExceeded,
+			Error(ErrorTimeout(nil))),
+	}})
+	assert.Equal(Error(ErrorTimeout(nil)), res.Error)
+}
+
+func TestWithMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next MethodFunc) MethodFunc {
+			return func(ctx context.Context,
+				params json.RawMessage) interface{} {
+				order = append(order, name)
+				if string(params) == `["limit"]` {
+					return ErrorRateLimited(name)
+				}
+				return next(ctx, params)
+			}
+		}
+	}
+	h := HTTPRequestHandler(MethodMap{
+		"echo": func(_ context.Context, params json.RawMessage) interface{} {
+			return params
+		}}, nil, WithMiddleware(mw("first"), mw("second")))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var c Client
+	var result []string
+	assert.NoError(c.Request(nil, srv.URL, "echo", []string{"a"}, &result))
+	assert.Equal([]string{"a"}, result)
+	assert.Equal([]string{"first", "second"}, order)
+
+	err := c.Request(nil, srv.URL, "echo", []string{"limit"}, &result)
+	assert.Equal(Error{ErrorCodeRateLimited, ErrorMessageRateLimited,
+		"first"}, err)
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+// StatusPolicy maps the outcome of an http.Request handled by the
+// HTTPRequestHandler to the HTTP status code of the http.Response.
+//
+// A zero value for any field means that the HTTP status code 200 OK is used,
+// which is the default for all outcomes.
+//
+// Only a single Response, or no Response at all, is mapped by the
+// StatusPolicy. A BatchResponse may contain a mix of results and errors, so
+// it is always sent with the HTTP status code 200 OK.
+//
+// Use WithStatusPolicy to set the StatusPolicy for the HTTPRequestHandler.
+type StatusPolicy struct {
+	// Notification is used when no Response is sent because the
+	// http.Request only contained Notifications.
+	Notification int
+
+	// ParseError is used for a Parse Error.
+	ParseError int
+
+	// InvalidRequest is used for an Invalid Request Error.
+	InvalidRequest int
+
+	// MethodNotFound is used for a Method not found Error.
+	MethodNotFound int
+
+	// InternalError is used for an Internal Error.
+	InternalError int
+}
+
+// ConventionalStatusPolicy returns a StatusPolicy that uses HTTP status codes
+// conventional for REST APIs, which some proxies and monitoring tools expect.
+func ConventionalStatusPolicy() StatusPolicy {
+	return StatusPolicy{
+		Notification:   204,
+		ParseError:     400,
+		InvalidRequest: 400,
+		MethodNotFound: 404,
+		InternalError:  500,
+	}
+}
+
+// WithStatusPolicy returns a HandlerOption that sets the StatusPolicy used by
+// the HTTPRequestHandler.
+func WithStatusPolicy(p StatusPolicy) HandlerOption {
+	return func(h *handler) {
+		h.status = p
+	}
+}
+
+// statusCode returns the HTTP status code for res, which is either nil, a
+// Response or a BatchResponse. If zero is returned, the default HTTP status
+// code should be used.
+func (p StatusPolicy) statusCode(res interface{}) int {
+	switch res := res.(type) {
+	case nil:
+		return p.Notification
+	case Response:
+		if !res.HasError() {
+			return 0
+		}
+		switch res.Error.Code {
+		case ErrorCodeParse:
+			return p.ParseError
+		case ErrorCodeInvalidRequest:
+			return p.InvalidRequest
+		case ErrorCodeMethodNotFound:
+			return p.MethodNotFound
+		case ErrorCodeInternal:
+			return p.InternalError
+		}
+	}
+	return 0
+}
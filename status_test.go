@@ -0,0 +1,103 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var statusTests = []struct {
+	Name         string
+	Body         string
+	Default      int
+	Conventional int
+}{{
+	Name:         "success",
+	Body:         `{"jsonrpc":"2.0","method":"ok","id":1}`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusOK,
+}, {
+	Name:         "notification",
+	Body:         `{"jsonrpc":"2.0","method":"ok"}`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusNoContent,
+}, {
+	Name:         "parse error",
+	Body:         `{"jsonrpc":"2.0","method"`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusBadRequest,
+}, {
+	Name:         "invalid request",
+	Body:         `{"jsonrpc":"2.0","method":1}`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusBadRequest,
+}, {
+	Name:         "method not found",
+	Body:         `{"jsonrpc":"2.0","method":"missing","id":1}`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusNotFound,
+}, {
+	Name:         "internal error",
+	Body:         `{"jsonrpc":"2.0","method":"panic","id":1}`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusInternalServerError,
+}, {
+	Name:         "batch",
+	Body:         `[{"jsonrpc":"2.0","method":"missing","id":1}]`,
+	Default:      http.StatusOK,
+	Conventional: http.StatusOK,
+}}
+
+func TestStatusPolicy(t *testing.T) {
+	methods := MethodMap{
+		"ok": func(_ context.Context, _ json.RawMessage) interface{} {
+			return true
+		},
+		"panic": func(_ context.Context, _ json.RawMessage) interface{} {
+			panic("panic")
+		},
+	}
+	def := HTTPRequestHandler(methods, nil)
+	conv := HTTPRequestHandler(methods, nil,
+		WithStatusPolicy(ConventionalStatusPolicy()))
+	for _, test := range statusTests {
+		t.Run(test.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := httptest.NewRecorder()
+			def(w, httptest.NewRequest(http.MethodPost, "/",
+				strings.NewReader(test.Body)))
+			assert.Equal(test.Default, w.Code)
+
+			w = httptest.NewRecorder()
+			conv(w, httptest.NewRequest(http.MethodPost, "/",
+				strings.NewReader(test.Body)))
+			assert.Equal(test.Conventional, w.Code)
+		})
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceContext identifies a span within a distributed trace, as defined by
+// the W3C Trace Context recommendation.
+//
+// Over HTTP, a TraceContext is propagated using the "traceparent" and
+// "tracestate" headers. The HTTPRequestHandler adds any valid TraceContext it
+// receives to the context.Context of each MethodFunc, and the Client sends
+// any TraceContext in the context.Context of each call, so trace context is
+// propagated across hops automatically.
+//
+// HTTP is currently the only transport, so trace context is never carried in
+// the "params" of a Request.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+
+	// Flags are the trace flags, such as TraceFlagSampled.
+	Flags byte
+
+	// State is the vendor specific "tracestate", which is propagated
+	// unmodified.
+	State string
+}
+
+// TraceFlagSampled is the trace flag indicating that the caller may have
+// recorded the trace.
+const TraceFlagSampled byte = 0x01
+
+// The HTTP headers used to propagate a TraceContext.
+const (
+	headerTraceParent = "Traceparent"
+	headerTraceState  = "Tracestate"
+)
+
+// ParseTraceParent parses a W3C "traceparent" header value. An error is
+// returned if it is not valid. The returned TraceContext has no State.
+func ParseTraceParent(traceparent string) (TraceContext, error) {
+	var tc TraceContext
+	invalid := func() (TraceContext, error) {
+		return TraceContext{}, fmt.Errorf("invalid traceparent: %q",
+			traceparent)
+	}
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 {
+		return invalid()
+	}
+	var version [1]byte
+	if !decodeHex(version[:], parts[0]) || version[0] == 0xff {
+		return invalid()
+	}
+	// Version 00 has exactly four fields, but later versions may append
+	// more fields, which are ignored.
+	if version[0] == 0 && len(parts) != 4 {
+		return invalid()
+	}
+	var flags [1]byte
+	if !decodeHex(tc.TraceID[:], parts[1]) ||
+		!decodeHex(tc.SpanID[:], parts[2]) ||
+		!decodeHex(flags[:], parts[3]) {
+		return invalid()
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return invalid()
+	}
+	return tc, nil
+}
+
+// decodeHex decodes exactly len(dst) bytes of lowercase hex from src into
+// dst, or returns false.
+func decodeHex(dst []byte, src string) bool {
+	if len(src) != hex.EncodedLen(len(dst)) || strings.ToLower(src) != src {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+// IsValid returns true if neither tc.TraceID nor tc.SpanID are all zeros.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// TraceParent returns tc as a W3C "traceparent" header value.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// String returns tc.TraceParent().
+func (tc TraceContext) String() string {
+	return tc.TraceParent()
+}
+
+// NewChild returns a TraceContext for a new span within the trace of tc,
+// with a random SpanID. If tc is not valid, a new sampled trace with a random
+// TraceID is started.
+func (tc TraceContext) NewChild() TraceContext {
+	if !tc.IsValid() {
+		tc = TraceContext{Flags: TraceFlagSampled}
+		randomID(tc.TraceID[:])
+	}
+	randomID(tc.SpanID[:])
+	return tc
+}
+
+// randomID fills id with random bytes that are not all zeros.
+func randomID(id []byte) {
+	for {
+		rand.Read(id)
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
+
+// traceContextKey is the context.Context key for a TraceContext.
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying tc.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the TraceContext carried by ctx, or false if there
+// is none. The ctx may be nil.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// extractTrace returns ctx carrying any valid TraceContext in header.
+func extractTrace(ctx context.Context, header http.Header) context.Context {
+	tc, err := ParseTraceParent(header.Get(headerTraceParent))
+	if err != nil {
+		return ctx
+	}
+	tc.State = header.Get(headerTraceState)
+	return ContextWithTrace(ctx, tc)
+}
+
+// injectTrace sets the headers for any TraceContext carried by ctx.
+func injectTrace(ctx context.Context, header http.Header) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok || !tc.IsValid() {
+		return
+	}
+	header.Set(headerTraceParent, tc.TraceParent())
+	if tc.State != "" {
+		header.Set(headerTraceState, tc.State)
+	}
+}
+
+// SpanKind is the role of a Span in a call.
+type SpanKind int
+
+const (
+	// SpanServer is a Span for a call received by the
+	// HTTPRequestHandler.
+	SpanServer SpanKind = iota
+
+	// SpanClient is a Span for a call made by a Client.
+	SpanClient
+)
+
+// String returns "server" or "client".
+func (k SpanKind) String() string {
+	if k == SpanClient {
+		return "client"
+	}
+	return "server"
+}
+
+// The attribute keys set on each Span.
+const (
+	// AttributeMethod is the method name of the Request.
+	AttributeMethod = "rpc.method"
+
+	// AttributeRequestID is the "id" of the Request as JSON. It is not set
+	// for Notifications.
+	AttributeRequestID = "rpc.jsonrpc.request_id"
+
+	// AttributeBatchIndex is the index of the Request within a batch
+	// request. It is not set if the Request was not part of a batch.
+	AttributeBatchIndex = "rpc.jsonrpc.batch_index"
+)
+
+// Tracer starts a Span for each call made by a Client, or received by the
+// HTTPRequestHandler. Implementations must be safe for concurrent use.
+//
+// Use WithTracer to set the Tracer for the HTTPRequestHandler, or set
+// Client.Tracer. See TraceRecorder for an in-memory implementation, or wrap a
+// tracing library.
+type Tracer interface {
+	// StartSpan starts a Span named name as a child of any TraceContext
+	// carried by ctx, and returns a copy of ctx carrying the
+	// TraceContext of the new Span, so that it is propagated by any
+	// calls made with the returned context.Context.
+	StartSpan(ctx context.Context, name string,
+		kind SpanKind) (context.Context, Span)
+}
+
+// Span is a single traced call started by a Tracer.
+type Span interface {
+	// SetAttribute annotates the Span. See AttributeMethod for the keys
+	// used.
+	SetAttribute(key string, value interface{})
+
+	// End ends the Span. The err is nil on success, an Error if the
+	// Response had an Error, and otherwise any other error returned by
+	// the Client.
+	End(err error)
+}
+
+// WithTracer returns a HandlerOption that starts a Span using t for each
+// Request, including each Request of a batch request and Notifications. The
+// context.Context passed to the MethodFunc carries the TraceContext of the
+// Span.
+//
+// The Span is named after the method, except that, like WithMetrics, any
+// Request for a method not in the MethodMap, or that is invalid, uses an
+// empty name.
+func WithTracer(t Tracer) HandlerOption {
+	return func(h *handler) {
+		h.tracer = traceHook{t}
+	}
+}
+
+// traceHook starts Spans using any Tracer it holds, and otherwise does
+// nothing.
+type traceHook struct {
+	t Tracer
+}
+
+// start starts a Span named name, or returns ctx and a Span that does
+// nothing if there is no Tracer.
+func (h traceHook) start(ctx context.Context, name string,
+	kind SpanKind) (context.Context, Span) {
+
+	if h.t == nil {
+		return ctx, nopSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return h.t.StartSpan(ctx, name, kind)
+}
+
+// nopSpan is a Span that does nothing.
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, interface{}) {}
+func (nopSpan) End(error)                        {}
+
+// TraceRecorder is an in-memory Tracer, mainly for tests. The zero value is
+// ready to use.
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a Span recorded by a TraceRecorder.
+type RecordedSpan struct {
+	Name string
+	Kind SpanKind
+
+	// TraceContext identifies the Span, and Parent is the TraceContext
+	// from the context.Context it was started with, if any.
+	TraceContext TraceContext
+	Parent       TraceContext
+
+	Attributes map[string]interface{}
+
+	// Err is the error the Span ended with, and Ended is true once it
+	// has ended.
+	Err   error
+	Ended bool
+
+	Start, End time.Time
+}
+
+// recordingSpan is the Span returned by a TraceRecorder.
+type recordingSpan struct {
+	r *TraceRecorder
+	s *RecordedSpan
+}
+
+// StartSpan implements Tracer.
+func (r *TraceRecorder) StartSpan(ctx context.Context, name string,
+	kind SpanKind) (context.Context, Span) {
+
+	parent, _ := TraceFromContext(ctx)
+	s := RecordedSpan{
+		Name:         name,
+		Kind:         kind,
+		TraceContext: parent.NewChild(),
+		Parent:       parent,
+		Attributes:   make(map[string]interface{}),
+		Start:        time.Now(),
+	}
+	r.mu.Lock()
+	r.spans = append(r.spans, &s)
+	r.mu.Unlock()
+	return ContextWithTrace(ctx, s.TraceContext), recordingSpan{r, &s}
+}
+
+func (s recordingSpan) SetAttribute(key string, value interface{}) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Attributes[key] = value
+}
+
+func (s recordingSpan) End(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	if s.s.Ended {
+		return
+	}
+	s.s.Err = err
+	s.s.Ended = true
+	s.s.End = time.Now()
+}
+
+// Spans returns a copy of all Spans started so far, in the order they were
+// started.
+func (r *TraceRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+		spans[i].Attributes = make(map[string]interface{},
+			len(s.Attributes))
+		for k, v := range s.Attributes {
+			spans[i].Attributes[k] = v
+		}
+	}
+	return spans
+}
+
+// Reset discards all recorded Spans.
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
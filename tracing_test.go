@@ -0,0 +1,191 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseTraceParentTests = []struct {
+	TraceParent string
+	Valid       bool
+}{
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+	{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", true},
+	{"", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xyz", false},
+	{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+	{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+	{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", false},
+	{"0-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", false},
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for _, test := range parseTraceParentTests {
+		tc, err := ParseTraceParent(test.TraceParent)
+		if !test.Valid {
+			assert.Error(t, err, test.TraceParent)
+			continue
+		}
+		if assert.NoError(t, err, test.TraceParent) &&
+			strings.HasPrefix(test.TraceParent, "00") {
+			assert.Equal(t, test.TraceParent, tc.TraceParent())
+		}
+	}
+}
+
+func TestTraceContextNewChild(t *testing.T) {
+	assert := assert.New(t)
+	root := TraceContext{}.NewChild()
+	assert.True(root.IsValid())
+	assert.Equal(TraceFlagSampled, root.Flags)
+
+	child := root.NewChild()
+	assert.True(child.IsValid())
+	assert.Equal(root.TraceID, child.TraceID)
+	assert.NotEqual(root.SpanID, child.SpanID)
+}
+
+func TestWithTracer(t *testing.T) {
+	assert := assert.New(t)
+	var rec TraceRecorder
+	var methodTrace TraceContext
+	methods := MethodMap{
+		"trace": func(ctx context.Context, _ json.RawMessage) interface{} {
+			methodTrace, _ = TraceFromContext(ctx)
+			return nil
+		},
+		"fail": func(context.Context, json.RawMessage) interface{} {
+			return NewError(1, "fail", nil)
+		},
+	}
+	h := HTTPRequestHandler(methods, nil, WithTracer(&rec))
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	parent, _ := ParseTraceParent(traceparent)
+	parent.State = "vendor=value"
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"trace","id":"a"}`))
+	req.Header.Set("traceparent", traceparent)
+	req.Header.Set("tracestate", parent.State)
+	h(httptest.NewRecorder(), req)
+
+	spans := rec.Spans()
+	if !assert.Len(spans, 1) {
+		return
+	}
+	span := spans[0]
+	assert.Equal("trace", span.Name)
+	assert.Equal(SpanServer, span.Kind)
+	assert.Equal(parent, span.Parent)
+	assert.Equal(parent.TraceID, span.TraceContext.TraceID)
+	assert.Equal(parent.State, span.TraceContext.State)
+	assert.Equal(span.TraceContext, methodTrace)
+	assert.True(span.Ended)
+	assert.NoError(span.Err)
+	assert.Equal(map[string]interface{}{
+		AttributeMethod:    "trace",
+		AttributeRequestID: `"a"`,
+	}, span.Attributes)
+
+	rec.Reset()
+	req = httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`[{"jsonrpc":"2.0","method":"fail","id":1},
+			{"jsonrpc":"2.0","method":"trace"},
+			{"jsonrpc":"2.0","method":"unknown","id":2}]`))
+	h(httptest.NewRecorder(), req)
+
+	spans = rec.Spans()
+	if !assert.Len(spans, 3) {
+		return
+	}
+	for i, span := range spans {
+		assert.Equal(i, span.Attributes[AttributeBatchIndex])
+		assert.False(span.Parent.IsValid())
+		assert.True(span.Ended)
+	}
+	assert.Equal("fail", spans[0].Name)
+	assert.Equal(NewError(1, "fail", nil), spans[0].Err)
+	assert.NotContains(spans[1].Attributes, AttributeRequestID)
+	assert.NoError(spans[1].Err)
+	assert.Equal("", spans[2].Name)
+	assert.Equal("unknown", spans[2].Attributes[AttributeMethod])
+	assert.Equal(ErrorCodeMethodNotFound, spans[2].Err.(Error).Code)
+}
+
+func TestClientTracer(t *testing.T) {
+	assert := assert.New(t)
+	var rec TraceRecorder
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			received = append(received,
+				req.Header.Get("traceparent")+
+					" "+req.Header.Get("tracestate"))
+			HTTPRequestHandler(metricsTestMethods, nil)(w, req)
+		}))
+	defer srv.Close()
+
+	// Without a Tracer, only the TraceContext of ctx is propagated.
+	var c Client
+	parent := TraceContext{}.NewChild()
+	parent.State = "k=v"
+	ctx := ContextWithTrace(context.Background(), parent)
+	assert.NoError(c.Request(ctx, srv.URL, "ok", nil, nil))
+	assert.NoError(c.Request(nil, srv.URL, "ok", nil, nil))
+	assert.Equal([]string{parent.TraceParent() + " k=v", " "}, received)
+
+	received = nil
+	c.Tracer = &rec
+	assert.NoError(c.Request(ctx, srv.URL, "ok", nil, nil))
+	assert.Error(c.Request(ctx, srv.URL, "fail", nil, nil))
+	assert.NoError(c.Notify(nil, srv.URL, "ok", nil))
+
+	spans := rec.Spans()
+	if !assert.Len(spans, 3) || !assert.Len(received, 3) {
+		return
+	}
+	for i, span := range spans {
+		assert.Equal(SpanClient, span.Kind)
+		assert.True(span.Ended)
+		assert.Equal(span.TraceContext.TraceParent(),
+			strings.Fields(received[i])[0])
+	}
+	assert.Equal(parent, spans[0].Parent)
+	assert.Equal(parent.TraceID, spans[0].TraceContext.TraceID)
+	assert.Contains(spans[0].Attributes, AttributeRequestID)
+	assert.Equal(NewError(1, "fail", nil), spans[1].Err)
+	assert.False(spans[2].Parent.IsValid())
+	assert.NotContains(spans[2].Attributes, AttributeRequestID)
+}
@@ -21,28 +21,84 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
 
-// validateID assumes that id is valid JSON and returns true if len(id) == 0,
-// or id represents a JSON Number, String or Null.
+// IDPolicy controls which Request IDs are accepted in addition to the rules
+// of the JSON-RPC 2.0 Spec. The zero value is the default policy.
+//
+// Use WithIDPolicy to set the IDPolicy for the HTTPRequestHandler.
+type IDPolicy struct {
+	// AllowFractional allows Number IDs with a fractional part, such as
+	// 1.5, which are rejected by default since the Spec says that
+	// Numbers SHOULD NOT contain fractional parts. Numbers with an
+	// integral value, such as 1.0 or 1e3, are always allowed.
+	AllowFractional bool
+
+	// RejectNull rejects null IDs, which are allowed by default although
+	// the Spec says that the ID SHOULD normally not be Null.
+	RejectNull bool
+}
+
+// WithIDPolicy returns a HandlerOption that sets the IDPolicy used by the
+// HTTPRequestHandler to validate Request IDs.
+func WithIDPolicy(p IDPolicy) HandlerOption {
+	return func(h *handler) {
+		h.idPolicy = p
+	}
+}
+
+// validateID returns an error if id does not represent a JSON Number, String
+// or Null, or is not allowed by the default IDPolicy.
+func validateID(id json.RawMessage) error {
+	return IDPolicy{}.validateID(id)
+}
+
+// validateID returns an error if id does not represent a JSON Number, String
+// or Null that is allowed by p.
 //
 // From the JSONRPC 2.0 Spec:
 //
 // id
 //      An identifier established by the Client that MUST contain a String,
-//      Number, or NULL value if included.
+//      Number, or NULL value if included. [...] The value SHOULD normally not
+//      be Null and Numbers SHOULD NOT contain fractional parts.
 //
-// Below is the JSON grammar for String, Number and Null from JSON.org.
-//      value
-//          string
-//          number
-//          "null"
-//
-//      string
-//          '"' characters '"'
+// The JSON type is determined by the first byte. Null and String IDs are
+// assumed to be otherwise valid JSON, but Numbers are fully validated against
+// the JSON number grammar, since the fraction and exponent must be inspected
+// anyway. See validateNumber.
+func (p IDPolicy) validateID(id json.RawMessage) error {
+	if len(id) == 0 {
+		return fmt.Errorf(`invalid "id": empty`)
+	}
+	switch b := id[0]; {
+	case b == 'n': // null
+		if p.RejectNull {
+			return fmt.Errorf(`invalid "id": null is not allowed`)
+		}
+	case b == '"': // string
+	case b == '-' || isDigit(b): // number
+		integral, err := validateNumber(id)
+		if err != nil {
+			return fmt.Errorf(`invalid "id": %w`, err)
+		}
+		if !integral && !p.AllowFractional {
+			return fmt.Errorf(`invalid "id": %s has a fractional part`, id)
+		}
+	default:
+		return fmt.Errorf(`invalid "id": not a number, string, or null: %v`,
+			jsonType(b))
+	}
+	return nil
+}
+
+// validateNumber returns an error if num does not exactly match the JSON
+// number grammar, and otherwise whether the value of num is an integer.
 //
+// Below is the JSON grammar for Number from JSON.org.
 //      number
 //          integer fraction exponent
 //
@@ -72,28 +128,101 @@ import (
 //          'E' sign digits
 //          'e' sign digits
 //
-// Thus if we know that we are working with valid JSON, we can determine the
-// JSON type by the first byte alone.
-func validateID(id json.RawMessage) error {
-	if len(id) == 0 {
-		return fmt.Errorf(`invalid "id": empty`)
+//      sign
+//          ""
+//          '+'
+//          '-'
+func validateNumber(num []byte) (integral bool, _ error) {
+	i := 0
+	digits := func() []byte {
+		start := i
+		for i < len(num) && isDigit(num[i]) {
+			i++
+		}
+		return num[start:i]
 	}
-	b := id[0]
-	if b == 'n' || // null
-		b == '"' || // string
-		isNumber(b) {
-		return nil
+
+	// integer
+	if i < len(num) && num[i] == '-' {
+		i++
+	}
+	integer := digits()
+	if len(integer) == 0 {
+		return false, fmt.Errorf("invalid number %q: missing integer digits", num)
+	}
+	if len(integer) > 1 && integer[0] == '0' {
+		return false, fmt.Errorf("invalid number %q: leading zero", num)
 	}
-	return fmt.Errorf(`invalid "id": not a number, string, or null`)
+
+	// fraction
+	var fraction []byte
+	if i < len(num) && num[i] == '.' {
+		i++
+		if fraction = digits(); len(fraction) == 0 {
+			return false, fmt.Errorf(
+				"invalid number %q: missing fraction digits", num)
+		}
+	}
+
+	// exponent
+	var exp int64
+	if i < len(num) && (num[i] == 'e' || num[i] == 'E') {
+		i++
+		neg := false
+		if i < len(num) && (num[i] == '+' || num[i] == '-') {
+			neg = num[i] == '-'
+			i++
+		}
+		expDigits := digits()
+		if len(expDigits) == 0 {
+			return false, fmt.Errorf(
+				"invalid number %q: missing exponent digits", num)
+		}
+		for _, d := range expDigits {
+			// Saturate, since any exponent this large exceeds
+			// the number of digits.
+			if exp < 1<<32 {
+				exp = 10*exp + int64(d-'0')
+			}
+		}
+		if neg {
+			exp = -exp
+		}
+	}
+
+	if i != len(num) {
+		return false, fmt.Errorf("invalid number %q: unexpected %q",
+			num, num[i])
+	}
+
+	// The value is the significant digits scaled by 10^scale. It is an
+	// integer if it is zero, or if any negative scale is offset by
+	// trailing zeros.
+	significant := bytes.TrimLeft(append(append([]byte{}, integer...),
+		fraction...), "0")
+	if len(significant) == 0 {
+		return true, nil
+	}
+	zeros := len(significant) - len(bytes.TrimRight(significant, "0"))
+	scale := exp - int64(len(fraction))
+	return scale >= 0 || int64(zeros) >= -scale, nil
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
 }
 
-func isNumber(b byte) bool {
-	if b == '-' || ('0' <= b && b <= '9') || // integer
-		b == 'E' || b == 'e' || // exponent
-		b == '.' { // fraction
-		return true
+// jsonType returns the name of the JSON type that begins with b.
+func jsonType(b byte) string {
+	switch b {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
 	}
-	return false
+	return fmt.Sprintf("%q", b)
 }
 
 // validateParams assumes that params is valid JSON and returns true if params is
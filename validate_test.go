@@ -0,0 +1,94 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validateIDTests = []struct {
+	ID     string
+	Policy IDPolicy
+	Err    string
+}{
+	{ID: `null`},
+	{ID: `"1.5"`},
+	{ID: `0`},
+	{ID: `-0`},
+	{ID: `123`},
+	{ID: `-123`},
+	{ID: `1.0`},
+	{ID: `1.50e1`},
+	{ID: `1E+3`},
+	{ID: `100e-2`},
+	{ID: `0.0e-5`},
+	{ID: `1e99999999999999999999`},
+	{ID: `null`, Policy: IDPolicy{RejectNull: true},
+		Err: `invalid "id": null is not allowed`},
+	{ID: `1.5`, Err: `invalid "id": 1.5 has a fractional part`},
+	{ID: `1.5`, Policy: IDPolicy{AllowFractional: true}},
+	{ID: `1e-1`, Err: `invalid "id": 1e-1 has a fractional part`},
+	{ID: `10e-2`, Err: `invalid "id": 10e-2 has a fractional part`},
+	{ID: `1e-99999999999999999999`,
+		Err: `invalid "id": 1e-99999999999999999999 has a fractional part`},
+	{ID: ``, Err: `invalid "id": empty`},
+	{ID: `01`, Err: `invalid "id": invalid number "01": leading zero`},
+	{ID: `-`, Err: `invalid "id": invalid number "-": missing integer digits`},
+	{ID: `1.`, Err: `invalid "id": invalid number "1.": missing fraction digits`},
+	{ID: `1e+`, Err: `invalid "id": invalid number "1e+": missing exponent digits`},
+	{ID: `1x`, Err: `invalid "id": invalid number "1x": unexpected 'x'`},
+	{ID: `.5`, Err: `invalid "id": not a number, string, or null: '.'`},
+	{ID: `e5`, Err: `invalid "id": not a number, string, or null: 'e'`},
+	{ID: `{}`, Err: `invalid "id": not a number, string, or null: object`},
+	{ID: `[]`, Err: `invalid "id": not a number, string, or null: array`},
+	{ID: `true`, Err: `invalid "id": not a number, string, or null: boolean`},
+}
+
+func TestValidateID(t *testing.T) {
+	for _, test := range validateIDTests {
+		err := test.Policy.validateID(json.RawMessage(test.ID))
+		if test.Err == "" {
+			assert.NoError(t, err, test.ID)
+		} else {
+			assert.EqualError(t, err, test.Err, test.ID)
+		}
+	}
+}
+
+func TestWithIDPolicy(t *testing.T) {
+	assert := assert.New(t)
+	h := handler{idPolicy: IDPolicy{RejectNull: true}}
+	_, err := h.unmarshalRequest(json.RawMessage(
+		`{"jsonrpc":"2.0","method":"m","id":null}`))
+	assert.EqualError(err, `invalid "id": null is not allowed`)
+
+	_, err = h.unmarshalRequest(json.RawMessage(
+		`{"jsonrpc":"2.0","method":"m","id":1.5}`))
+	assert.EqualError(err, `invalid "id": 1.5 has a fractional part`)
+
+	WithIDPolicy(IDPolicy{AllowFractional: true})(&h)
+	_, err = h.unmarshalRequest(json.RawMessage(
+		`{"jsonrpc":"2.0","method":"m","id":1.5}`))
+	assert.NoError(err)
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WithVersion1 returns a HandlerOption that makes the HTTPRequestHandler
+// accept JSON-RPC 1.0 Requests in addition to JSON-RPC 2.0 Requests.
+//
+// The version is determined for each Request from the fields present. A
+// Request without a "jsonrpc" field is treated as JSON-RPC 1.0, which
+// requires any "params" to be an array and uses a null "id" for
+// Notifications. Responses to JSON-RPC 1.0 Requests are sent in JSON-RPC 1.0
+// format, which omits "jsonrpc" and always includes both "result" and
+// "error", one of which is null.
+//
+// This takes precedence over DecodePolicy.MissingVersion.
+func WithVersion1() HandlerOption {
+	return func(h *handler) {
+		h.version1 = true
+	}
+}
+
+// jRequest1 is a JSON-RPC 1.0 Request, which has no "jsonrpc" field, and
+// always includes "params" and "id", which is null for Notifications.
+type jRequest1 struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// marshalJSON1 marshals r as a JSON-RPC 1.0 Request or Notification. See
+// Request.MarshalJSON.
+func (r Request) marshalJSON1() ([]byte, error) {
+	jR := jRequest1{Method: r.Method,
+		Params: json.RawMessage("[]"),
+		ID:     json.RawMessage("null")}
+	if r.ID != nil {
+		id, err := marshalJSON(r.ID)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid "id": %w`, err)
+		}
+		if err := (IDPolicy{RejectNull: true}).validateID(id); err != nil {
+			return nil, err
+		}
+		jR.ID = id
+	}
+	if r.Params != nil {
+		params, err := marshalJSON(r.Params)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid "params": %w`, err)
+		}
+		if err := validateParams1(params); err != nil {
+			return nil, err
+		}
+		if string(params) != "null" {
+			jR.Params = params
+		}
+	}
+	return marshalJSON(jR)
+}
+
+// validateParams1 returns an error if params is not a JSON array or null, as
+// required by JSON-RPC 1.0.
+func validateParams1(params json.RawMessage) error {
+	if err := validateParams(params); err != nil {
+		return err
+	}
+	if params[0] == '{' {
+		return fmt.Errorf(`invalid "params": JSON-RPC 1.0 requires an array`)
+	}
+	return nil
+}
+
+// jResponse1 is a JSON-RPC 1.0 Response, which has no "jsonrpc" field, and
+// always includes both "result" and "error", one of which is null.
+type jResponse1 struct {
+	Result interface{} `json:"result"`
+	Error  *Error      `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+// marshalJSON1 marshals r as a JSON-RPC 1.0 Response. See
+// Response.MarshalJSON.
+func (r Response) marshalJSON1() ([]byte, error) {
+	jR := jResponse1{Result: r.Result, ID: r.ID}
+	if r.HasError() {
+		jR.Error = &r.Error
+		jR.Result = nil
+	}
+	return marshalJSON(jR)
+}
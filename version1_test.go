@@ -0,0 +1,142 @@
+// Copyright 2018 Adam S Levy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var version1Tests = []struct {
+	Name string
+	Req  string
+	Res  string
+}{{
+	Name: "request",
+	Req:  `{"method":"add","params":[1,2],"id":1}`,
+	Res:  `{"result":3,"error":null,"id":1}`,
+}, {
+	Name: "notification",
+	Req:  `{"method":"add","params":[1,2],"id":null}`,
+}, {
+	Name: "2.0 request",
+	Req:  `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":1}`,
+	Res:  `{"jsonrpc":"2.0","result":3,"id":1}`,
+}, {
+	Name: "2.0 null id",
+	Req:  `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":null}`,
+	Res:  `{"jsonrpc":"2.0","result":3,"id":null}`,
+}, {
+	Name: "method not found",
+	Req:  `{"method":"sub","params":[],"id":"a"}`,
+	Res: `{"result":null,"error":{"code":-32601,"message":"Method not found",` +
+		`"data":"sub"},"id":"a"}`,
+}, {
+	Name: "object params",
+	Req:  `{"method":"add","params":{},"id":1}`,
+	Res: `{"result":null,"error":{"code":-32600,"message":"Invalid Request",` +
+		`"data":"invalid \"params\": JSON-RPC 1.0 requires an array"},` +
+		`"id":null}`,
+}, {
+	Name: "batch",
+	Req: `[{"method":"add","params":[1,2],"id":1},` +
+		`{"jsonrpc":"2.0","method":"add","params":[3,4],"id":2}]`,
+	Res: `[{"result":3,"error":null,"id":1},` +
+		`{"jsonrpc":"2.0","result":7,"id":2}]`,
+}}
+
+var version1Methods = MethodMap{
+	"add": func(_ context.Context, params json.RawMessage) interface{} {
+		var nums []int
+		if err := json.Unmarshal(params, &nums); err != nil {
+			return ErrorInvalidParams(err.Error())
+		}
+		var sum int
+		for _, n := range nums {
+			sum += n
+		}
+		return sum
+	},
+}
+
+func TestWithVersion1(t *testing.T) {
+	h := HTTPRequestHandler(version1Methods, nil, WithVersion1())
+	for _, test := range version1Tests {
+		t.Run(test.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(test.Req)))
+			res := test.Res
+			if res != "" {
+				res += "\n"
+			}
+			assert.Equal(t, res, w.Body.String())
+		})
+	}
+
+	// Without WithVersion1, JSON-RPC 1.0 Requests are invalid.
+	h = HTTPRequestHandler(version1Methods, nil)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(version1Tests[0].Req)))
+	assert.Contains(t, w.Body.String(), `"code":-32600`)
+}
+
+func TestClientVersion1(t *testing.T) {
+	assert := assert.New(t)
+
+	var reqs []string
+	h := HTTPRequestHandler(version1Methods, nil, WithVersion1())
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			buf.ReadFrom(r.Body)
+			reqs = append(reqs, buf.String())
+			r.Body = ioutil.NopCloser(&buf)
+			h(w, r)
+		}))
+	defer srv.Close()
+
+	c := Client{Version1: true}
+	var sum int
+	assert.NoError(c.Request(nil, srv.URL, "add", []int{1, 2}, &sum))
+	assert.Equal(3, sum)
+	assert.Regexp(`^{"method":"add","params":\[1,2\],"id":\d+}$`, reqs[0])
+
+	err := c.Request(nil, srv.URL, "sub", nil, &sum)
+	assert.Equal(Error{Code: ErrorCodeMethodNotFound,
+		Message: "Method not found", Data: "sub"}, err)
+	assert.Regexp(`^{"method":"sub","params":\[\],"id":\d+}$`, reqs[1])
+
+	assert.NoError(c.Notify(nil, srv.URL, "add", []int{1}))
+	assert.Equal(`{"method":"add","params":[1],"id":null}`, reqs[2])
+
+	assert.EqualError(c.Request(nil, srv.URL, "add", struct{}{}, &sum),
+		`invalid "params": JSON-RPC 1.0 requires an array`)
+	assert.Len(reqs, 3)
+}